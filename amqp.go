@@ -11,8 +11,22 @@ type amqpResource struct {
 	url.URL
 }
 
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (a amqpResource) String() string {
+	return redactURL(a.URL)
+}
+
 func (a amqpResource) Await(ctx context.Context) error {
-	conn, err := amqp.Dial(a.String())
+	tlsConfig, err := tlsConfigOf(a.URL)
+	if err != nil {
+		return err
+	}
+	var conn *amqp.Connection
+	if tlsConfig != nil && a.URL.Scheme == "amqps" {
+		conn, err = amqp.DialTLS(a.URL.String(), tlsConfig)
+	} else {
+		conn, err = amqp.Dial(a.URL.String())
+	}
 	if err != nil {
 		return &unavailabilityError{Reason: err}
 	}
@@ -23,11 +23,13 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 )
 
-const retryDelay = 500 * time.Millisecond
-
 type timeoutError struct {
 	Reason error
 }
@@ -37,67 +39,504 @@ func (e *timeoutError) Error() string {
 	return e.Reason.Error()
 }
 
-type awaiter struct {
-	logger  *LevelLogger
+// awaitOptions controls how a resource is awaited, independent of its type.
+type awaitOptions struct {
+	// timeout limits the duration of awaiting the resource, if set. It cannot
+	// exceed the overall timeout.
 	timeout time.Duration
+	backoff backoff
+	// attemptTimeout limits the duration of a single attempt, if set.
+	attemptTimeout time.Duration
+	// minSuccesses and stableFor define how many consecutive successful
+	// attempts, spanning at least how long, are required before a resource
+	// is considered available.
+	minSuccesses int
+	stableFor    time.Duration
+	// failFast aborts awaiting on errors which are not expected to resolve by
+	// retrying, e.g. rejected credentials.
+	failFast bool
+}
+
+var defaultAwaitOptions = awaitOptions{
+	backoff:      defaultBackoff,
+	minSuccesses: 1,
+	failFast:     true,
+}
+
+// isStable reports whether the given streak of consecutive successful
+// attempts suffices to consider a resource available.
+func (o awaitOptions) isStable(successes int, duration time.Duration) bool {
+	return successes >= o.minSuccesses && duration >= o.stableFor
+}
+
+// target is a resource along with the options controlling how it is awaited.
+type target struct {
+	resource
+	// name optionally identifies the resource in reports and dependencies.
+	name    string
+	options awaitOptions
+	// after lists the names of the resources which must be available before
+	// this one is awaited, resolved into dependencies by linkDependencies.
+	after        []string
+	dependencies []*target
+}
+
+// parseAwaitOptions reads the await options from the fragment of a resource
+// URL, falling back to the given defaults for absent keys.
+func parseAwaitOptions(u url.URL, defaults awaitOptions) (awaitOptions, error) {
+	opts := defaults
+
+	var err error
+	durationOpt := func(key string, val *time.Duration) {
+		if s := getOptOrDefault(u, key, ""); s != "" && err == nil {
+			if *val, err = time.ParseDuration(s); err == nil && *val < 0 {
+				err = errors.New("must not be negative")
+			}
+			if err != nil {
+				err = fmt.Errorf("%v: invalid value for '%s' configuration: %v", redactURL(u), key, err)
+			}
+		}
+	}
+	intOpt := func(key string, val *int) {
+		if s := getOptOrDefault(u, key, ""); s != "" && err == nil {
+			if *val, err = strconv.Atoi(s); err == nil && *val < 1 {
+				err = errors.New("must be positive")
+			}
+			if err != nil {
+				err = fmt.Errorf("%v: invalid value for '%s' configuration: %v", redactURL(u), key, err)
+			}
+		}
+	}
+	boolOpt := func(key string, val *bool) {
+		if s := getOptOrDefault(u, key, ""); s != "" && err == nil {
+			if *val, err = strconv.ParseBool(s); err != nil {
+				err = fmt.Errorf("%v: invalid value for '%s' configuration: %v", redactURL(u), key, err)
+			}
+		}
+	}
+	floatOpt := func(key string, val *float64) {
+		if s := getOptOrDefault(u, key, ""); s != "" && err == nil {
+			if *val, err = strconv.ParseFloat(s, 64); err == nil && *val < 0 {
+				err = errors.New("must not be negative")
+			}
+			if err != nil {
+				err = fmt.Errorf("%v: invalid value for '%s' configuration: %v", redactURL(u), key, err)
+			}
+		}
+	}
+
+	durationOpt("timeout", &opts.timeout)
+	durationOpt("retry-delay", &opts.backoff.initial)
+	floatOpt("retry-multiplier", &opts.backoff.multiplier)
+	durationOpt("retry-max-delay", &opts.backoff.max)
+	floatOpt("retry-jitter", &opts.backoff.jitter)
+	durationOpt("attempt-timeout", &opts.attemptTimeout)
+	intOpt("stable", &opts.minSuccesses)
+	durationOpt("stable-for", &opts.stableFor)
+	boolOpt("fail-fast", &opts.failFast)
+
+	if err != nil {
+		return opts, &resourceConfigError{err}
+	}
+	return opts, nil
+}
+
+// availability enumerates the states a resource can be in.
+type availability int
+
+const (
+	unavailable availability = iota
+	available
+	misconfigured
+	failed
+)
+
+// String implements the fmt.Stringer interface.
+func (a availability) String() string {
+	switch a {
+	case available:
+		return "available"
+	case misconfigured:
+		return "config error"
+	case failed:
+		return "failed"
+	default:
+		return "unavailable"
+	}
+}
+
+// resourceStatus is a snapshot of the progress of awaiting a single resource.
+type resourceStatus struct {
+	Name     string
+	Resource resource
+	State    availability
+	Attempts int
+	// Duration is the time it took the resource to become available or, if it
+	// never did, the time spent awaiting it.
+	Duration  time.Duration
+	LatestErr error
+}
+
+// resourceState records the progress of awaiting a single resource. It is
+// shared between the goroutine awaiting the resource and the awaiter
+// collecting the results, hence all access is synchronised.
+type resourceState struct {
+	mu        sync.Mutex
+	name      string
+	resource  resource
+	available bool
+	attempts  int
+	started   time.Time
+	finished  time.Time
+	latestErr error
+	// pendingErr explains why a resource is not available yet although its
+	// latest attempt succeeded.
+	pendingErr error
+	// permanentErr is set if awaiting was aborted due to a permanent error.
+	permanentErr *permanentError
+}
+
+func (s *resourceState) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attempts == 0 {
+		s.started = time.Now()
+	}
+	s.attempts++
+}
+
+func (s *resourceState) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The duration tracks the time to become available, hence only changes
+	// on transitions, which happen repeatedly while monitoring.
+	switch {
+	case err == nil && !s.available:
+		s.finished = time.Now()
+	case err != nil && s.available:
+		s.started = time.Now()
+	}
+	s.available = err == nil
+	s.pendingErr = nil
+	if err != nil {
+		// Keep the latest failure around even once available, as it explains
+		// why it took as long as it did.
+		s.latestErr = err
+	}
+}
+
+func (s *resourceState) pending(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pendingErr = err
+}
+
+func (s *resourceState) abort(err *permanentError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permanentErr = err
+}
+
+func (s *resourceState) permanentError() *permanentError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.permanentErr
+}
+
+func (s *resourceState) snapshot() resourceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := resourceStatus{
+		Name:      s.name,
+		Resource:  s.resource,
+		Attempts:  s.attempts,
+		LatestErr: s.latestErr,
+	}
+	switch {
+	case s.available:
+		status.State = available
+	case s.permanentErr != nil && s.permanentErr.Class == configClass, isConfigError(s.latestErr):
+		status.State = misconfigured
+	case s.permanentErr != nil:
+		status.State = failed
+	default:
+		status.State = unavailable
+	}
+	switch {
+	case s.attempts == 0:
+		// Never even started, e.g. when awaiting sequentially
+	case s.available:
+		status.Duration = s.finished.Sub(s.started)
+	default:
+		status.Duration = time.Since(s.started)
+	}
+	if !s.available && s.pendingErr != nil {
+		status.LatestErr = s.pendingErr
+	} else if !s.available && s.latestErr == nil {
+		if s.attempts == 0 {
+			status.LatestErr = errors.New("not awaited")
+		} else {
+			// Time out even before the first try
+			status.LatestErr = errors.New("initial await did not finish")
+		}
+	}
+	return status
 }
 
-func (a *awaiter) run(resources []resource) error {
+func isConfigError(err error) bool {
+	return classify(err) == configClass
+}
+
+type awaiter struct {
+	logger     *LevelLogger
+	timeout    time.Duration
+	sequential bool
+	// metrics, if set, collects metrics of all attempts.
+	metrics *metrics
+
+	mu sync.Mutex
+	// states tracks the progress of the latest run, if any.
+	states []*resourceState
+}
+
+// statuses returns the current status of every resource of the latest run.
+func (a *awaiter) statuses() []resourceStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	statuses := make([]resourceStatus, len(a.states))
+	for i, state := range a.states {
+		statuses[i] = state.snapshot()
+	}
+	return statuses
+}
+
+// track starts tracking the given resources as unavailable, replacing the
+// states of any previous run, and returns their states in the given order.
+func (a *awaiter) track(targets []*target) []*resourceState {
+	states := make([]*resourceState, len(targets))
+	for i := range states {
+		states[i] = &resourceState{name: targets[i].name, resource: targets[i].resource}
+	}
+	a.mu.Lock()
+	a.states = states
+	a.mu.Unlock()
+	return states
+}
+
+// run awaits all given resources until they are available or the timeout is
+// exceeded. It returns the status of every resource, in the given order, in
+// both cases.
+func (a *awaiter) run(targets []*target) ([]resourceStatus, error) {
 	if a.logger == nil {
 		a.logger = NewLogger(errorLevel)
 	}
 
+	// The context gets cancelled as soon as any resource fails permanently,
+	// as the overall outcome is known by then.
 	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
-	var latestErr error
+	defer cancel()
 
-	go func() {
-		for _, res := range resources {
-			a.logger.Infof("Awaiting resource: %s", res)
+	states := a.track(targets)
 
-			for {
-				select {
-				case <-ctx.Done():
-					// Exceeded timeout
-					return
-				default:
-					// Still time left, let's continue
-				}
+	stateOf := map[*target]*resourceState{}
+	for i, t := range targets {
+		stateOf[t] = states[i]
+	}
+	// Closed as soon as the respective resource is available, to start
+	// awaiting the resources depending on it.
+	availableCh := map[*target]chan struct{}{}
+	for _, t := range targets {
+		availableCh[t] = make(chan struct{})
+	}
 
-				if latestErr = res.Await(ctx); latestErr != nil {
-					if e, ok := latestErr.(*unavailabilityError); ok {
-						// transient error
-						a.logger.Debugf("Resource unavailable: %v", e)
-					} else {
-						// Maybe transient error
-						a.logger.Errorf("Error: failed to await resource: %v", latestErr)
-					}
-					time.Sleep(retryDelay)
-				} else {
-					a.logger.Infof("Resource found: %s", res)
-					// Resource found, move on to next one
-					break
+	done := make(chan struct{})
+	if a.sequential {
+		sorted, err := sortTargets(targets)
+		if err != nil {
+			return nil, &resourceConfigError{err}
+		}
+		go func() {
+			defer close(done)
+			for _, t := range sorted {
+				if !a.await(ctx, cancel, t, stateOf[t]) {
+					return
 				}
 			}
+		}()
+	} else {
+		var wg sync.WaitGroup
+		for i, t := range targets {
+			wg.Add(1)
+			go func(t *target, state *resourceState) {
+				defer wg.Done()
+				if !a.awaitDependencies(ctx, t, state, availableCh) {
+					return
+				}
+				if a.await(ctx, cancel, t, state) {
+					close(availableCh[t])
+				}
+			}(t, states[i])
 		}
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+	}
 
-		cancel() // All resources are available
-	}()
+	// Resource implementations are not guaranteed to honour the context,
+	// therefore stop waiting for them as soon as the deadline is exceeded.
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
 
-	<-ctx.Done()
-	switch ctx.Err() {
-	case context.Canceled:
-		if latestErr != nil {
-			return latestErr
+	statuses := make([]resourceStatus, len(states))
+	var err error
+	for i, state := range states {
+		statuses[i] = state.snapshot()
+		if statuses[i].State != available && err == nil {
+			err = &unavailabilityError{statuses[i].LatestErr}
 		}
-		// All resources are available
-		return nil
-	case context.DeadlineExceeded:
-		if latestErr == nil {
-			// Time out even before the first try
-			latestErr = errors.New("initial await did not finish")
+	}
+	// A permanent error is the cause of all other resources being unavailable,
+	// hence takes precedence.
+	for _, state := range states {
+		if permanentErr := state.permanentError(); permanentErr != nil {
+			return statuses, permanentErr
+		}
+	}
+
+	return statuses, err
+}
+
+// awaitDependencies blocks until all dependencies of a resource are available.
+// It reports false if the context is done before.
+func (a *awaiter) awaitDependencies(ctx context.Context, t *target, state *resourceState, availableCh map[*target]chan struct{}) bool {
+	for _, dep := range t.dependencies {
+		state.pending(&unavailabilityError{fmt.Errorf("waiting for dependency: %s", dep.label())})
+		a.logger.Debugf("Resource waiting for dependency %s: %s", dep.label(), t)
+		select {
+		case <-availableCh[dep]:
+		case <-ctx.Done():
+			return false
 		}
-		return &unavailabilityError{latestErr}
+	}
+	state.pending(nil)
+	return true
+}
+
+// await retries a single resource until it is available or the context is
+// done. It reports whether the resource became available. On permanent errors
+// awaiting is given up and, unless opted out, abort gets called.
+func (a *awaiter) await(ctx context.Context, abort func(), t *target, state *resourceState) bool {
+	res := t.resource
+	a.logger.Infof("Awaiting resource: %s", res)
+
+	if t.options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.options.timeout)
+		defer cancel()
+	}
+
+	var (
+		began       = time.Now()
+		failures    int
+		successes   int
+		stableSince time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			// Exceeded timeout
+			return false
+		default:
+			// Still time left, let's continue
+		}
+
+		state.begin()
+		attemptStarted := time.Now()
+		err := attempt(ctx, t)
+		a.metrics.observeAttempt(t, time.Since(attemptStarted), err)
+
+		var delay time.Duration
+		if err == nil {
+			if successes == 0 {
+				stableSince = time.Now()
+			}
+			successes++
+			failures = 0
+			if t.options.isStable(successes, time.Since(stableSince)) {
+				state.record(nil)
+				a.metrics.observeAvailable(t, time.Since(began))
+				a.logger.Infof("Resource found: %s", res)
+				return true
+			}
+
+			state.pending(&unavailabilityError{fmt.Errorf("not stable yet: %d consecutive successes within %v",
+				successes, time.Since(stableSince).Round(time.Millisecond))})
+			a.logger.Debugf("Resource available, awaiting stability (%d consecutive successes): %s", successes, res)
+			delay = t.options.backoff.delay(1)
+		} else {
+			state.record(err)
+			if successes > 0 {
+				a.logger.Infof("Resource became unavailable again: %s", res)
+			}
+			successes = 0
+			failures++
+
+			if class := classify(err); class.permanent() && t.options.failFast {
+				a.logger.Errorf("Error: giving up on resource due to %s error: %v", class, err)
+				state.abort(&permanentError{err, class})
+				abort()
+				return false
+			}
+
+			if e, ok := err.(*unavailabilityError); ok {
+				// transient error
+				a.logger.Debugf("Resource unavailable: %v", e)
+			} else {
+				// Maybe transient error
+				a.logger.Errorf("Error: failed to await resource: %v", err)
+			}
+			delay = t.options.backoff.delay(failures)
+		}
+
+		if !sleep(ctx, delay) {
+			// Exceeded timeout
+			return false
+		}
+	}
+}
+
+// attempt awaits a resource once. If an attempt timeout is set, the attempt is
+// abandoned once exceeded, even if the resource implementation does not honour
+// the context.
+func attempt(ctx context.Context, t *target) error {
+	if t.options.attemptTimeout <= 0 {
+		return t.Await(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.options.attemptTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- t.Await(ctx)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Prefer the error of the resource if it gave up at the same time, as it is
+	// usually more descriptive.
+	select {
+	case err := <-errCh:
+		return err
 	default:
-		return errors.New("unknown error")
+		return &unavailabilityError{fmt.Errorf("attempt timed out after %v", t.options.attemptTimeout)}
 	}
 }
@@ -0,0 +1,345 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// fakeResource becomes available after a given number of failed attempts,
+// each attempt taking the given delay.
+type fakeResource struct {
+	name     string
+	delay    time.Duration
+	failures int32
+	attempts int32
+}
+
+func (r *fakeResource) String() string {
+	return r.name
+}
+
+func (r *fakeResource) Await(ctx context.Context) error {
+	attempt := atomic.AddInt32(&r.attempts, 1)
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return &unavailabilityError{ctx.Err()}
+	}
+	if attempt <= r.failures {
+		return &unavailabilityError{errors.New("not yet")}
+	}
+	return nil
+}
+
+// hangingResource blocks its first attempt forever, regardless of the context,
+// and is available afterwards.
+type hangingResource struct {
+	attempts int32
+}
+
+func (r *hangingResource) String() string {
+	return "hanging"
+}
+
+func (r *hangingResource) Await(context.Context) error {
+	if atomic.AddInt32(&r.attempts, 1) == 1 {
+		select {}
+	}
+	return nil
+}
+
+// sequenceResource returns the given results for its consecutive attempts and
+// is available once they are exhausted.
+type sequenceResource struct {
+	results  []error
+	attempts int32
+}
+
+func (r *sequenceResource) String() string {
+	return "sequence"
+}
+
+func (r *sequenceResource) Await(context.Context) error {
+	if attempt := int(atomic.AddInt32(&r.attempts, 1)); attempt <= len(r.results) {
+		return r.results[attempt-1]
+	}
+	return nil
+}
+
+func targetsOf(ress ...resource) []*target {
+	targets := make([]*target, len(ress))
+	for i, res := range ress {
+		targets[i] = &target{resource: res, options: defaultAwaitOptions}
+	}
+	return targets
+}
+
+func TestAwaiterConcurrent(t *testing.T) {
+	ress := []resource{
+		&fakeResource{name: "slow1", delay: 300 * time.Millisecond},
+		&fakeResource{name: "slow2", delay: 300 * time.Millisecond},
+		&fakeResource{name: "slow3", delay: 300 * time.Millisecond},
+	}
+
+	a := &awaiter{timeout: 600 * time.Millisecond}
+	if _, err := a.run(targetsOf(ress...)); err != nil {
+		t.Errorf("expected all resources to be available concurrently, got: %v", err)
+	}
+}
+
+func TestAwaiterSequential(t *testing.T) {
+	ress := []resource{
+		&fakeResource{name: "slow1", delay: 300 * time.Millisecond},
+		&fakeResource{name: "slow2", delay: 300 * time.Millisecond},
+		&fakeResource{name: "slow3", delay: 300 * time.Millisecond},
+	}
+
+	a := &awaiter{timeout: 500 * time.Millisecond, sequential: true}
+	statuses, err := a.run(targetsOf(ress...))
+	if _, ok := err.(*unavailabilityError); !ok {
+		t.Errorf("expected sequential await to time out, got: %v", err)
+	}
+	if attempts := atomic.LoadInt32(&ress[2].(*fakeResource).attempts); attempts != 0 {
+		t.Errorf("expected last resource to never be awaited, got %d attempts", attempts)
+	}
+	if s := statuses[2]; s.State != unavailable || s.Attempts != 0 || s.LatestErr == nil {
+		t.Errorf("expected last resource to be reported as not awaited, got: %+v", s)
+	}
+}
+
+func TestAwaiterRetriesUntilAvailable(t *testing.T) {
+	res := &fakeResource{name: "flaky", failures: 2}
+
+	a := &awaiter{timeout: 5 * time.Second}
+	statuses, err := a.run(targetsOf(res))
+	if err != nil {
+		t.Errorf("expected resource to become available, got: %v", err)
+	}
+	if attempts := atomic.LoadInt32(&res.attempts); attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if s := statuses[0]; s.State != available || s.Attempts != 3 || s.Duration == 0 {
+		t.Errorf("unexpected status of available resource: %+v", s)
+	}
+}
+
+func TestAwaiterTimeoutReportsLatestError(t *testing.T) {
+	ress := []resource{
+		&fakeResource{name: "available"},
+		&fakeResource{name: "unavailable", failures: 1000},
+	}
+
+	a := &awaiter{timeout: 200 * time.Millisecond}
+	statuses, err := a.run(targetsOf(ress...))
+	e, ok := err.(*unavailabilityError)
+	if !ok {
+		t.Fatalf("expected unavailability error, got: %v", err)
+	}
+	if e.Error() != "not yet" {
+		t.Errorf("expected latest error of unavailable resource, got: %v", e)
+	}
+	if len(statuses) != 2 || statuses[0].State != available || statuses[1].State != unavailable {
+		t.Errorf("unexpected statuses: %+v", statuses)
+	}
+}
+
+func TestAwaiterReportsConfigError(t *testing.T) {
+	res, err := parseResource("postgres://localhost/#tables")
+	if err != nil {
+		t.Fatalf("failed to parse resource: %v", err)
+	}
+
+	a := &awaiter{timeout: 200 * time.Millisecond}
+	statuses, _ := a.run(targetsOf(res))
+	if statuses[0].State != misconfigured {
+		t.Errorf("expected config error state, got: %v", statuses[0].State)
+	}
+}
+
+func TestAwaiterBackoffAbortsOnTimeout(t *testing.T) {
+	res := &fakeResource{name: "unavailable", failures: 1000}
+	targets := targetsOf(res)
+	targets[0].options.backoff = backoff{initial: time.Hour, multiplier: 1}
+
+	a := &awaiter{timeout: 200 * time.Millisecond}
+	started := time.Now()
+	if _, err := a.run(targets); err == nil {
+		t.Errorf("expected resource to be unavailable")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected retry delay to be aborted on timeout, took %v", elapsed)
+	}
+}
+
+func TestAwaiterAbandonsAttemptOnAttemptTimeout(t *testing.T) {
+	res := &hangingResource{}
+	targets := targetsOf(res)
+	targets[0].options.backoff = backoff{initial: 10 * time.Millisecond, multiplier: 1}
+	targets[0].options.attemptTimeout = 100 * time.Millisecond
+
+	a := &awaiter{timeout: 2 * time.Second}
+	statuses, err := a.run(targets)
+	if err != nil {
+		t.Errorf("expected hanging attempt to be abandoned and retried, got: %v", err)
+	}
+	if statuses[0].Attempts != 2 || statuses[0].LatestErr == nil {
+		t.Errorf("unexpected status: %+v", statuses[0])
+	}
+}
+
+func TestAwaiterRequiresConsecutiveSuccesses(t *testing.T) {
+	unavailableErr := &unavailabilityError{errors.New("restarting")}
+	res := &sequenceResource{results: []error{nil, unavailableErr, nil, nil, unavailableErr}}
+	targets := targetsOf(res)
+	targets[0].options.backoff = backoff{initial: 10 * time.Millisecond, multiplier: 1}
+	targets[0].options.minSuccesses = 3
+
+	a := &awaiter{timeout: 2 * time.Second}
+	statuses, err := a.run(targets)
+	if err != nil {
+		t.Errorf("expected resource to become stable, got: %v", err)
+	}
+	if statuses[0].Attempts != 8 {
+		t.Errorf("expected 8 attempts, got %d", statuses[0].Attempts)
+	}
+}
+
+func TestAwaiterRequiresStableDuration(t *testing.T) {
+	res := &sequenceResource{}
+	targets := targetsOf(res)
+	targets[0].options.backoff = backoff{initial: 20 * time.Millisecond, multiplier: 1}
+	targets[0].options.stableFor = 100 * time.Millisecond
+
+	a := &awaiter{timeout: 2 * time.Second}
+	statuses, err := a.run(targets)
+	if err != nil {
+		t.Errorf("expected resource to become stable, got: %v", err)
+	}
+	if statuses[0].Duration < 100*time.Millisecond || statuses[0].Attempts < 4 {
+		t.Errorf("expected resource to be probed for the stability duration, got: %+v", statuses[0])
+	}
+
+	targets[0].options.stableFor = time.Hour
+	a = &awaiter{timeout: 100 * time.Millisecond}
+	statuses, err = a.run(targets)
+	if err == nil {
+		t.Errorf("expected resource to never become stable")
+	}
+	if statuses[0].State != unavailable || statuses[0].LatestErr == nil {
+		t.Errorf("unexpected status of unstable resource: %+v", statuses[0])
+	}
+}
+
+func TestAwaiterFailsFastOnPermanentError(t *testing.T) {
+	authErr := &unavailabilityError{&mysql.MySQLError{Number: 1045, Message: "Access denied"}}
+	targets := targetsOf(
+		&sequenceResource{results: []error{authErr}},
+		&fakeResource{name: "unavailable", failures: 1000},
+	)
+
+	a := &awaiter{timeout: 5 * time.Second}
+	started := time.Now()
+	statuses, err := a.run(targets)
+	if e, ok := err.(*permanentError); !ok || e.Class != authClass {
+		t.Errorf("expected permanent auth error, got: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected awaiting to be aborted, took %v", elapsed)
+	}
+	if statuses[0].State != failed || statuses[1].State != unavailable {
+		t.Errorf("unexpected statuses: %+v", statuses)
+	}
+
+	targets = targetsOf(&sequenceResource{results: []error{authErr}})
+	targets[0].options.failFast = false
+	if _, err := a.run(targets); err != nil {
+		t.Errorf("expected permanent error to be retried when opted out, got: %v", err)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := backoff{initial: 100 * time.Millisecond, multiplier: 2, max: time.Second}
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, e := range expected {
+		if d := b.delay(i + 1); d != e {
+			t.Errorf("unexpected delay for attempt %d: expected %v, got %v", i+1, e, d)
+		}
+	}
+
+	b = backoff{initial: time.Second, multiplier: 1, jitter: 0.5}
+	for i := 1; i < 100; i++ {
+		if d := b.delay(i); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Errorf("jittered delay out of bounds: %v", d)
+		}
+	}
+}
+
+func TestParseAwaitOptions(t *testing.T) {
+	targets, err := parseTargets([]string{
+		"http://localhost",
+		"http://localhost#retry-delay=1s&retry-multiplier=1.5&retry-max-delay=10s&retry-jitter=0.2&attempt-timeout=3s&stable=3&stable-for=10s&fail-fast=false",
+	}, defaultAwaitOptions)
+	if err != nil {
+		t.Fatalf("failed to parse resources: %v", err)
+	}
+	if targets[0].options.backoff != defaultBackoff {
+		t.Errorf("expected default backoff, got: %+v", targets[0].options.backoff)
+	}
+	expected := backoff{initial: time.Second, multiplier: 1.5, max: 10 * time.Second, jitter: 0.2}
+	if targets[1].options.backoff != expected {
+		t.Errorf("unexpected backoff: %+v", targets[1].options.backoff)
+	}
+	if targets[1].options.attemptTimeout != 3*time.Second {
+		t.Errorf("unexpected attempt timeout: %v", targets[1].options.attemptTimeout)
+	}
+	if targets[1].options.minSuccesses != 3 || targets[1].options.stableFor != 10*time.Second || targets[1].options.failFast {
+		t.Errorf("unexpected stability options: %+v", targets[1].options)
+	}
+
+	for _, invalid := range []string{
+		"http://localhost#retry-delay=soon",
+		"http://localhost#retry-delay=-1s",
+		"http://localhost#retry-multiplier=x",
+		"http://localhost#retry-jitter=-1",
+		"http://localhost#attempt-timeout=1",
+		"http://localhost#stable=0",
+		"http://localhost#stable=many",
+		"http://localhost#fail-fast=maybe",
+	} {
+		if _, err := parseTargets([]string{invalid}, awaitOptions{}); err == nil {
+			t.Errorf("expected error parsing invalid options of '%v', but got none", invalid)
+		}
+	}
+}
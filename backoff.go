@@ -0,0 +1,91 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const retryDelay = 500 * time.Millisecond
+
+var (
+	// The global source of math/rand is not seeded prior to Go 1.20, which
+	// would make all instances started together jitter in lockstep.
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// backoff defines the delays between consecutive attempts of awaiting a
+// resource: starting with an initial delay, each delay is multiplied by the
+// multiplier and capped to the max delay (if set). Each delay is randomly
+// varied by the fraction given as jitter, e.g. 0.1 for +/-10%.
+type backoff struct {
+	initial    time.Duration
+	multiplier float64
+	max        time.Duration
+	jitter     float64
+}
+
+var defaultBackoff = backoff{
+	initial:    retryDelay,
+	multiplier: 1,
+}
+
+// delay returns the delay to wait after the given (1-based) failed attempt.
+func (b backoff) delay(attempt int) time.Duration {
+	d := float64(b.initial) * math.Pow(b.multiplier, float64(attempt-1))
+	if b.max > 0 && d > float64(b.max) {
+		d = float64(b.max)
+	}
+	if b.jitter > 0 {
+		jitterMu.Lock()
+		d += d * b.jitter * (2*jitterRand.Float64() - 1)
+		jitterMu.Unlock()
+	}
+	if b.max > 0 && d > float64(b.max) {
+		d = float64(b.max)
+	}
+	if d < 0 || math.IsNaN(d) {
+		return 0
+	}
+	if d > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+// sleep waits for the given duration, but aborts as soon as the context is
+// done. It reports whether the full duration elapsed.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
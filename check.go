@@ -0,0 +1,141 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// checkCommand is the name of the subcommand checking resources once.
+const checkCommand = "check"
+
+// runCheck implements the check subcommand, awaiting every resource exactly
+// once without retrying. As required by e.g. the HEALTHCHECK of Docker, it
+// only returns 0 if all resources are available and 1 otherwise, including on
+// invalid arguments.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet(checkCommand, flag.ContinueOnError)
+	var (
+		configFlag  = fs.String("c", "", "Read resources from YAML or JSON configuration file, '-' to read from stdin")
+		outputFlag  = fs.String("o", textOutput, "Set output format of the report: text, json")
+		quietFlag   = fs.Bool("q", false, "Set quiet mode")
+		timeoutFlag = fs.Duration("t", 5*time.Second, "Set timeout duration of the attempt of every resource")
+		verboseFlag = fs.Bool("v", false, "Set verbose output mode")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: await check [options...] <res>...")
+		fmt.Fprintln(os.Stderr, "Check availability of resources once.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUnavailable
+	}
+
+	logLevel := errorLevel
+	switch {
+	case *verboseFlag:
+		logLevel = infoLevel
+	case *quietFlag:
+		logLevel = silentLevel
+	}
+	logger := NewLogger(logLevel)
+
+	if *outputFlag != textOutput && *outputFlag != jsonOutput {
+		logger.Errorf("Error: unsupported output format: %s", *outputFlag)
+		return exitUnavailable
+	}
+	if *timeoutFlag <= 0 {
+		logger.Errorln("Error: timeout must be positive")
+		return exitUnavailable
+	}
+	targets, err := parseTargets(fs.Args(), defaultAwaitOptions)
+	if err != nil {
+		logger.Errorf("Error: failed to parse resources: %v", err)
+		return exitUnavailable
+	}
+	if *configFlag != "" {
+		cfg, err := readConfig(*configFlag)
+		if err == nil {
+			var cfgTargets []*target
+			cfgTargets, err = cfg.targets(defaultAwaitOptions)
+			targets = append(targets, cfgTargets...)
+		}
+		if err != nil {
+			logger.Errorf("Error: failed to read configuration file: %v", err)
+			return exitUnavailable
+		}
+	}
+	if err := linkDependencies(targets); err != nil {
+		logger.Errorf("Error: failed to parse resources: %v", err)
+		return exitUnavailable
+	}
+
+	started := time.Now()
+	statuses := check(targets, *timeoutFlag)
+
+	exitCode := exitOK
+	if len(unavailableResources(statuses)) > 0 {
+		exitCode = exitUnavailable
+	}
+	var reportErr error
+	switch {
+	case *outputFlag == jsonOutput:
+		reportErr = printJSONReport(os.Stdout, statuses, exitCode, time.Since(started))
+	case logLevel < silentLevel && len(statuses) > 0:
+		reportErr = printReport(os.Stderr, statuses)
+	}
+	if reportErr != nil {
+		logger.Errorf("Error: failed to print report: %v", reportErr)
+	}
+	return exitCode
+}
+
+// check awaits all resources concurrently, exactly once each, abandoning
+// attempts which exceed the timeout.
+func check(targets []*target, timeout time.Duration) []resourceStatus {
+	states := make([]*resourceState, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		states[i] = &resourceState{name: t.name, resource: t.resource}
+		wg.Add(1)
+		go func(t *target, state *resourceState) {
+			defer wg.Done()
+			state.begin()
+			state.record(attempt(context.Background(), &target{
+				resource: t.resource,
+				options:  awaitOptions{attemptTimeout: timeout},
+			}))
+		}(t, states[i])
+	}
+	wg.Wait()
+
+	statuses := make([]resourceStatus, len(states))
+	for i, state := range states {
+		statuses[i] = state.snapshot()
+	}
+	return statuses
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	failing := &fakeResource{name: "failing", failures: 1}
+	ress := []resource{
+		&fakeResource{name: "available"},
+		failing,
+		&hangingResource{},
+	}
+
+	started := time.Now()
+	statuses := check(targetsOf(ress...), 100*time.Millisecond)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected check to finish within attempt timeout, took %v", elapsed)
+	}
+
+	expected := []availability{available, unavailable, unavailable}
+	for i, status := range statuses {
+		if status.State != expected[i] || status.Attempts != 1 {
+			t.Errorf("unexpected status of %s: %+v", status.Resource, status)
+		}
+	}
+	if failing.attempts != 1 {
+		t.Errorf("expected no retries, got %d attempts", failing.attempts)
+	}
+	if !strings.Contains(statuses[2].LatestErr.Error(), "attempt timed out") {
+		t.Errorf("unexpected error of hanging resource: %v", statuses[2].LatestErr)
+	}
+}
+
+func TestRunCheckExitCode(t *testing.T) {
+	tests := map[string][]string{
+		"available":          {"-q", "true"},
+		"unavailable":        {"-q", "false"},
+		"invalid":            {"-q", "unknown://localhost"},
+		"unknown dependency": {"-q", "true#after=db"},
+		"cycle":              {"-q", "true#name=a&after=b", "true#name=b&after=a"},
+		"duplicate name":     {"-q", "true#name=a", "true#name=a"},
+	}
+	for name, args := range tests {
+		expected := exitUnavailable
+		if name == "available" {
+			expected = exitOK
+		}
+		if code := runCheck(args); code != expected {
+			t.Errorf("unexpected exit code of %s check: expected %d, got %d", name, expected, code)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"os/exec"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/segmentio/kafka-go"
+	"github.com/streadway/amqp"
+)
+
+// errorClass categorises errors encountered while awaiting a resource.
+type errorClass int
+
+const (
+	// transientClass covers errors which may resolve by retrying, e.g. a
+	// refused connection. It is assumed for all unrecognised errors.
+	transientClass errorClass = iota
+	// configClass covers invalid resource definitions, e.g. a malformed DSN.
+	configClass
+	// authClass covers rejected credentials or insufficient permissions.
+	authClass
+	// tlsClass covers failed TLS certificate verifications.
+	tlsClass
+	// notFoundClass covers missing entities which will not appear by
+	// themselves, e.g. an unknown database.
+	notFoundClass
+)
+
+// String implements the fmt.Stringer interface.
+func (c errorClass) String() string {
+	switch c {
+	case configClass:
+		return "config"
+	case authClass:
+		return "auth"
+	case tlsClass:
+		return "tls"
+	case notFoundClass:
+		return "not-found"
+	default:
+		return "transient"
+	}
+}
+
+// permanent reports whether errors of this class are not expected to resolve
+// by retrying.
+func (c errorClass) permanent() bool {
+	return c != transientClass
+}
+
+// permanentError is returned when awaiting a resource was aborted due to an
+// error which is not expected to resolve by retrying.
+type permanentError struct {
+	Reason error
+	Class  errorClass
+}
+
+// Error implements the error interface.
+func (e *permanentError) Error() string {
+	return e.Reason.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *permanentError) Unwrap() error {
+	return e.Reason
+}
+
+// classify determines the class of an error returned by a resource.
+func classify(err error) errorClass {
+	var (
+		configErr        *resourceConfigError
+		unknownAuthority x509.UnknownAuthorityError
+		certInvalid      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		pqErr            *pq.Error
+		mysqlErr         *mysql.MySQLError
+		kafkaErr         kafka.Error
+		amqpErr          *amqp.Error
+	)
+
+	switch {
+	case err == nil:
+		return transientClass
+	case errors.As(err, &configErr), errors.Is(err, exec.ErrNotFound):
+		return configClass
+	case errors.As(err, &unknownAuthority), errors.As(err, &certInvalid), errors.As(err, &hostname):
+		return tlsClass
+	case errors.As(err, &pqErr):
+		return classifyPostgreSQL(pqErr)
+	case errors.As(err, &mysqlErr):
+		return classifyMySQL(mysqlErr)
+	case errors.As(err, &kafkaErr):
+		return classifyKafka(kafkaErr)
+	case errors.As(err, &amqpErr):
+		if amqpErr.Code == amqp.AccessRefused {
+			return authClass
+		}
+	case errors.Is(err, pq.ErrSSLNotSupported), errors.Is(err, pq.ErrSSLKeyHasWorldPermissions),
+		errors.Is(err, pq.ErrSSLKeyUnknownOwnership), errors.Is(err, pq.ErrCouldNotDetectUsername):
+		return configClass
+	case errors.Is(err, mysql.ErrNoTLS), errors.Is(err, mysql.ErrCleartextPassword),
+		errors.Is(err, mysql.ErrNativePassword), errors.Is(err, mysql.ErrOldPassword),
+		errors.Is(err, mysql.ErrUnknownPlugin):
+		return configClass
+	}
+	return transientClass
+}
+
+func classifyPostgreSQL(err *pq.Error) errorClass {
+	switch err.Code.Class() {
+	case "28": // invalid_authorization_specification, invalid_password
+		return authClass
+	case "3D": // invalid_catalog_name
+		return notFoundClass
+	case "42":
+		if err.Code == "42501" { // insufficient_privilege
+			return authClass
+		}
+	}
+	return transientClass
+}
+
+func classifyMySQL(err *mysql.MySQLError) errorClass {
+	switch err.Number {
+	case 1044, // ER_DBACCESS_DENIED_ERROR
+		1045, // ER_ACCESS_DENIED_ERROR
+		1698: // ER_ACCESS_DENIED_NO_PASSWORD_ERROR
+		return authClass
+	case 1049: // ER_BAD_DB_ERROR
+		return notFoundClass
+	}
+	return transientClass
+}
+
+func classifyKafka(err kafka.Error) errorClass {
+	switch err {
+	case kafka.SASLAuthenticationFailed, kafka.ClusterAuthorizationFailed,
+		kafka.TopicAuthorizationFailed:
+		return authClass
+	case kafka.UnsupportedSASLMechanism, kafka.IllegalSASLState:
+		return configClass
+	}
+	return transientClass
+}
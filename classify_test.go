@@ -0,0 +1,59 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/segmentio/kafka-go"
+	"github.com/streadway/amqp"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected errorClass
+	}{
+		{errors.New("connection refused"), transientClass},
+		{&unavailabilityError{errors.New("503 Service Unavailable")}, transientClass},
+		{&resourceConfigError{errors.New("invalid database name")}, configClass},
+		{&url.Error{Op: "Get", URL: "https://localhost", Err: x509.UnknownAuthorityError{}}, tlsClass},
+		{&unavailabilityError{&pq.Error{Code: "28P01"}}, authClass},
+		{&unavailabilityError{&pq.Error{Code: "3D000"}}, notFoundClass},
+		{&unavailabilityError{&pq.Error{Code: "57P03"}}, transientClass}, // cannot_connect_now
+		{&unavailabilityError{&mysql.MySQLError{Number: 1045}}, authClass},
+		{&unavailabilityError{&mysql.MySQLError{Number: 1049}}, notFoundClass},
+		{&unavailabilityError{fmt.Errorf("handshake: %w", kafka.SASLAuthenticationFailed)}, authClass},
+		{&unavailabilityError{kafka.LeaderNotAvailable}, transientClass},
+		{&unavailabilityError{amqp.ErrCredentials}, authClass},
+	}
+	for _, test := range tests {
+		if actual := classify(test.err); actual != test.expected {
+			t.Errorf("unexpected class of '%v': expected %v, got %v", test.err, test.expected, actual)
+		}
+	}
+}
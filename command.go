@@ -32,6 +32,11 @@ type commandResource struct {
 	url.URL
 }
 
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (r *commandResource) String() string {
+	return redactURL(r.URL)
+}
+
 func (r *commandResource) Await(ctx context.Context) error {
 	cmdString, err := url.QueryUnescape(r.URL.Path)
 	if err != nil {
@@ -45,7 +50,7 @@ func (r *commandResource) Await(ctx context.Context) error {
 	cmd := cmdParts[0]
 	args := cmdParts[1:]
 
-	if err := exec.CommandContext(ctx, cmd, args...).Run(); err != nil {
+	if err := ownedProcesses.run(exec.CommandContext(ctx, cmd, args...)); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			return &unavailabilityError{exitErr}
 		}
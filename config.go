@@ -0,0 +1,356 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config describes resources and options to await as read from a YAML or
+// JSON file.
+type config struct {
+	Timeout    *time.Duration   `yaml:"timeout"`
+	Sequential *bool            `yaml:"sequential"`
+	Defaults   optionsConfig    `yaml:"defaults"`
+	Resources  []resourceConfig `yaml:"resources"`
+}
+
+// optionsConfig holds the options controlling how resources are awaited. All
+// of them are optional, absent ones retain their default.
+type optionsConfig struct {
+	AttemptTimeout *time.Duration `yaml:"attempt-timeout"`
+	Retry          retryConfig    `yaml:"retry"`
+	Stable         *int           `yaml:"stable"`
+	StableFor      *time.Duration `yaml:"stable-for"`
+	FailFast       *bool          `yaml:"fail-fast"`
+}
+
+type retryConfig struct {
+	Delay      *time.Duration `yaml:"delay"`
+	Multiplier *float64       `yaml:"multiplier"`
+	MaxDelay   *time.Duration `yaml:"max-delay"`
+	Jitter     *float64       `yaml:"jitter"`
+}
+
+// tlsConfig holds the TLS options shared by all resources supporting TLS.
+type tlsConfig struct {
+	SkipVerify bool   `yaml:"skip-verify"`
+	CA         string `yaml:"ca"`
+	Cert       string `yaml:"cert"`
+	Key        string `yaml:"key"`
+	ServerName string `yaml:"server-name"`
+	MinVersion string `yaml:"min-version"`
+}
+
+// httpConfig holds the options of HTTP resources.
+type httpConfig struct {
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Status  []string          `yaml:"status"`
+	// Assertions on the response body
+	BodyContains string `yaml:"body-contains"`
+	BodyRegex    string `yaml:"body-regex"`
+	BodyJSON     string `yaml:"body-json"`
+	// Transport of the request
+	Redirect string `yaml:"redirect"`
+	Proxy    string `yaml:"proxy"`
+	Protocol string `yaml:"protocol"`
+}
+
+// groupConfig describes a group of resources, available once at least Min of
+// them are.
+type groupConfig struct {
+	Min       int      `yaml:"min"`
+	Resources []string `yaml:"resources"`
+}
+
+type resourceConfig struct {
+	Name          string         `yaml:"name"`
+	URL           string         `yaml:"url"`
+	Group         *groupConfig   `yaml:"group"`
+	After         []string       `yaml:"after"`
+	Timeout       *time.Duration `yaml:"timeout"`
+	TLS           tlsConfig      `yaml:"tls"`
+	HTTP          *httpConfig    `yaml:"http"`
+	optionsConfig `yaml:",inline"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface, allowing resources
+// to be given as plain URL as well.
+func (r *resourceConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&r.URL)
+	}
+	// Decode into a distinct type to not recurse into this method
+	type plain resourceConfig
+	return value.Decode((*plain)(r))
+}
+
+// readConfig reads a configuration from a YAML or JSON file, '-' to read from
+// stdin.
+func readConfig(filepath string) (*config, error) {
+	f := os.Stdin
+	if filepath != "-" {
+		var err error
+		if f, err = os.Open(filepath); err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+	}
+	return parseConfig(f)
+}
+
+func parseConfig(r io.Reader) (*config, error) {
+	// JSON being a subset of YAML, a YAML decoder suffices for both.
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	var c config
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// flagValues returns the global options of the configuration, keyed by the
+// name of the corresponding command line flag.
+func (c *config) flagValues() map[string]string {
+	vals := map[string]string{}
+	if c.Timeout != nil {
+		vals["t"] = c.Timeout.String()
+	}
+	if c.Sequential != nil {
+		vals["s"] = strconv.FormatBool(*c.Sequential)
+	}
+	for key, val := range c.Defaults.fragmentValues() {
+		if key == "stable" {
+			key = "min-successes"
+		}
+		vals[key] = val[0]
+	}
+	return vals
+}
+
+// targets returns the configured resources, with the given defaults applied
+// to absent options.
+func (c *config) targets(defaults awaitOptions) ([]*target, error) {
+	var targets []*target
+	names := map[string]bool{}
+	for i, r := range c.Resources {
+		if (r.URL == "") == (r.Group == nil) {
+			return nil, fmt.Errorf("resource #%d: either url or group required", i+1)
+		}
+		if r.Name != "" {
+			if names[r.Name] {
+				return nil, fmt.Errorf("duplicate resource name: %s", r.Name)
+			}
+			names[r.Name] = true
+		}
+
+		var t *target
+		var err error
+		if r.Group != nil {
+			t, err = r.groupTarget(defaults)
+		} else {
+			t, err = r.target(defaults)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.Name != "" {
+			t.name = r.Name
+		}
+		if len(r.After) > 0 {
+			t.after = r.After
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func (r resourceConfig) target(defaults awaitOptions) (*target, error) {
+	u, err := parseURL(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	opts := r.options()
+	if err := r.TLS.setFragmentValues(opts); err != nil {
+		return nil, err
+	}
+	if r.HTTP != nil {
+		if err := r.HTTP.setFragmentValues(opts); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts) > 0 {
+		// Explicit options take precedence over the ones given in the URL
+		fragment := parseFragment(u.EscapedFragment())
+		for key, val := range opts {
+			fragment[key] = val
+		}
+		setFragment(u, fragment)
+	}
+	return newTarget(*u, defaults)
+}
+
+func (r resourceConfig) groupTarget(defaults awaitOptions) (*target, error) {
+	if r.TLS != (tlsConfig{}) || r.HTTP != nil {
+		return nil, fmt.Errorf("group: tls and http options must be given per member")
+	}
+	min := r.Group.Min
+	if min == 0 {
+		min = 1
+	}
+	g, err := newGroup(r.Group.Resources, min)
+	if err != nil {
+		return nil, &resourceConfigError{fmt.Errorf("group: %v", err)}
+	}
+	// Groups lacking a URL, parse their options from a bare fragment
+	var u url.URL
+	setFragment(&u, r.options())
+	opts, err := parseAwaitOptions(u, defaults)
+	if err != nil {
+		return nil, err
+	}
+	return &target{resource: g, options: opts}, nil
+}
+
+// setFragmentValues sets the options as fragment key/value pairs, with their
+// placeholders resolved.
+func (c tlsConfig) setFragmentValues(opts url.Values) error {
+	if c.SkipVerify {
+		opts.Set("tls", "skip-verify")
+	}
+	for key, val := range map[string]string{
+		"tls-ca":          c.CA,
+		"tls-cert":        c.Cert,
+		"tls-key":         c.Key,
+		"tls-server-name": c.ServerName,
+		"tls-min-version": c.MinVersion,
+	} {
+		if val == "" {
+			continue
+		}
+		expanded, err := expandValuePlaceholders(val)
+		if err != nil {
+			return err
+		}
+		opts.Set(key, expanded)
+	}
+	return nil
+}
+
+// setFragmentValues sets the options as fragment key/value pairs, with their
+// placeholders resolved.
+func (c *httpConfig) setFragmentValues(opts url.Values) error {
+	set := func(key, val string) error {
+		expanded, err := expandValuePlaceholders(val)
+		if err == nil {
+			opts.Add(key, expanded)
+		}
+		return err
+	}
+
+	if c.Method != "" {
+		if err := set("method", c.Method); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(c.Headers))
+	for name := range c.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := set("header", name+":"+c.Headers[name]); err != nil {
+			return err
+		}
+	}
+	for key, val := range map[string]string{
+		"body":          c.Body,
+		"body-contains": c.BodyContains,
+		"body-regex":    c.BodyRegex,
+		"body-json":     c.BodyJSON,
+		"redirect":      c.Redirect,
+		"proxy":         c.Proxy,
+		"protocol":      c.Protocol,
+	} {
+		if val == "" {
+			continue
+		}
+		if err := set(key, val); err != nil {
+			return err
+		}
+	}
+	if len(c.Status) > 0 {
+		opts.Set("status", strings.Join(c.Status, ","))
+	}
+	return nil
+}
+
+// options returns the options of the resource as fragment key/value pairs.
+func (r resourceConfig) options() url.Values {
+	opts := r.fragmentValues()
+	if r.Timeout != nil {
+		opts.Set("timeout", r.Timeout.String())
+	}
+	return opts
+}
+
+// fragmentValues returns the options as fragment key/value pairs.
+func (o optionsConfig) fragmentValues() url.Values {
+	vals := url.Values{}
+	setDuration := func(key string, val *time.Duration) {
+		if val != nil {
+			vals.Set(key, val.String())
+		}
+	}
+	setFloat := func(key string, val *float64) {
+		if val != nil {
+			vals.Set(key, strconv.FormatFloat(*val, 'g', -1, 64))
+		}
+	}
+
+	setDuration("attempt-timeout", o.AttemptTimeout)
+	setDuration("retry-delay", o.Retry.Delay)
+	setFloat("retry-multiplier", o.Retry.Multiplier)
+	setDuration("retry-max-delay", o.Retry.MaxDelay)
+	setFloat("retry-jitter", o.Retry.Jitter)
+	if o.Stable != nil {
+		vals.Set("stable", strconv.Itoa(*o.Stable))
+	}
+	setDuration("stable-for", o.StableFor)
+	if o.FailFast != nil {
+		vals.Set("fail-fast", strconv.FormatBool(*o.FailFast))
+	}
+	return vals
+}
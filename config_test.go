@@ -0,0 +1,212 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`
+timeout: 2m
+sequential: true
+defaults:
+  attempt-timeout: 5s
+  retry:
+    delay: 1s
+    multiplier: 2
+  stable: 2
+resources:
+  - true
+  - name: db
+    url: postgres://localhost:5432/app#tables=users,orders
+    timeout: 30s
+    retry:
+      max-delay: 10s
+      jitter: 0.5
+    stable-for: 10s
+    fail-fast: false
+  - name: web
+    url: https://localhost:8443/health
+    tls:
+      skip-verify: true
+      server-name: web.internal
+      min-version: "1.2"
+`))
+	if err != nil {
+		t.Fatalf("failed to parse configuration: %v", err)
+	}
+
+	expectedFlags := map[string]string{
+		"t":                "2m0s",
+		"s":                "true",
+		"attempt-timeout":  "5s",
+		"retry-delay":      "1s",
+		"retry-multiplier": "2",
+		"min-successes":    "2",
+	}
+	flags := cfg.flagValues()
+	if len(flags) != len(expectedFlags) {
+		t.Errorf("unexpected flag values: %v", flags)
+	}
+	for name, expected := range expectedFlags {
+		if flags[name] != expected {
+			t.Errorf("unexpected value of flag '%s': expected %s, got %s", name, expected, flags[name])
+		}
+	}
+
+	targets, err := cfg.targets(defaultAwaitOptions)
+	if err != nil {
+		t.Fatalf("failed to parse resources of configuration: %v", err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("unexpected number of resources: %d", len(targets))
+	}
+	if targets[0].name != "" || targets[0].String() != "true" || targets[0].options != defaultAwaitOptions {
+		t.Errorf("unexpected resource given as plain URL: %+v", targets[0])
+	}
+
+	db := targets[1]
+	if db.name != "db" {
+		t.Errorf("unexpected name: %s", db.name)
+	}
+	if db.options.timeout != 30*time.Second || db.options.backoff.max != 10*time.Second ||
+		db.options.backoff.jitter != 0.5 || db.options.stableFor != 10*time.Second || db.options.failFast {
+		t.Errorf("unexpected options: %+v", db.options)
+	}
+	if tables := getOptOrDefault(db.resource.(*postgresqlResource).URL, "tables", ""); tables != "users,orders" {
+		t.Errorf("expected fragment of URL to be retained, got tables: %s", tables)
+	}
+
+	if tls := getOptOrDefault(targets[2].resource.(*httpResource).URL, "tls", ""); tls != "skip-verify" {
+		t.Errorf("expected TLS options to be set, got: %s", tls)
+	}
+	if name := getOptOrDefault(targets[2].resource.(*httpResource).URL, "tls-server-name", ""); name != "web.internal" {
+		t.Errorf("expected TLS server name to be set, got: %s", name)
+	}
+}
+
+func TestParseConfigFailure(t *testing.T) {
+	invalid := []string{
+		"unknown: true",
+		"timeout: 10",
+		"resources: [{name: db}]",
+		"resources: [{name: db, url: 'true'}, {name: db, url: 'true'}]",
+		"resources: [{url: 'http://localhost', retry: {delay: -1s}}]",
+		"resources: [{url: 'http://localhost', group: {resources: ['http://localhost']}}]",
+		"resources: [{group: {min: 2, resources: ['http://localhost']}}]",
+	}
+	for _, c := range invalid {
+		cfg, err := parseConfig(strings.NewReader(c))
+		if err == nil {
+			_, err = cfg.targets(defaultAwaitOptions)
+		}
+		if err == nil {
+			t.Errorf("expected error parsing invalid configuration '%v', but got none", c)
+		}
+	}
+}
+
+func TestParseJSONConfig(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`{
+		"timeout": "10s",
+		"resources": [{"name": "web", "url": "http://localhost:8080", "stable": 3}]
+	}`))
+	if err != nil {
+		t.Fatalf("failed to parse configuration: %v", err)
+	}
+	targets, err := cfg.targets(defaultAwaitOptions)
+	if err != nil {
+		t.Fatalf("failed to parse resources of configuration: %v", err)
+	}
+	if len(targets) != 1 || targets[0].name != "web" || targets[0].options.minSuccesses != 3 {
+		t.Errorf("unexpected resources: %+v", targets)
+	}
+}
+
+func TestParseGroupConfig(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`
+resources:
+  - name: brokers
+    group:
+      min: 2
+      resources: [kafka://k1:9092, kafka://k2:9092, kafka://k3:9092]
+    timeout: 30s
+`))
+	if err != nil {
+		t.Fatalf("failed to parse configuration: %v", err)
+	}
+	targets, err := cfg.targets(defaultAwaitOptions)
+	if err != nil {
+		t.Fatalf("failed to parse resources of configuration: %v", err)
+	}
+	g, ok := targets[0].resource.(*groupResource)
+	if !ok || g.min != 2 || len(g.members) != 3 {
+		t.Errorf("unexpected group: %v", targets[0].resource)
+	}
+	if targets[0].name != "brokers" || targets[0].options.timeout != 30*time.Second {
+		t.Errorf("unexpected group options: %+v", targets[0])
+	}
+}
+
+func TestParseHTTPConfig(t *testing.T) {
+	t.Setenv("AWAIT_TEST_TOKEN", "s3cr3t")
+	cfg, err := parseConfig(strings.NewReader(`
+resources:
+  - url: http://localhost:8080/health
+    http:
+      method: HEAD
+      headers:
+        Authorization: Bearer ${AWAIT_TEST_TOKEN}
+        Accept: application/json
+        X-Query: a=b&c+d%20
+      status: [200, 3xx]
+      body-json: $.status == "UP"
+      redirect: none
+      proxy: none
+      protocol: http/1.1
+`))
+	if err != nil {
+		t.Fatalf("failed to parse configuration: %v", err)
+	}
+	targets, err := cfg.targets(defaultAwaitOptions)
+	if err != nil {
+		t.Fatalf("failed to parse resources of configuration: %v", err)
+	}
+	res := targets[0].resource.(*httpResource)
+	if res.method != "HEAD" || res.headers.Get("Authorization") != "Bearer s3cr3t" || res.headers.Get("Accept") != "application/json" {
+		t.Errorf("unexpected HTTP options: %s %v", res.method, res.headers)
+	}
+	if res.headers.Get("X-Query") != "a=b&c+d%20" {
+		t.Errorf("expected header value to be taken verbatim, got: %s", res.headers.Get("X-Query"))
+	}
+	if strings.Join(res.status, ",") != "200,3xx" {
+		t.Errorf("unexpected accepted status: %v", res.status)
+	}
+	if len(res.assertions) != 1 {
+		t.Errorf("expected body assertion, got %d", len(res.assertions))
+	}
+	if res.followRedirects || res.proxy != nil || res.protocol != http1Protocol {
+		t.Errorf("unexpected transport options: %+v", res)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// linkDependencies resolves the names of the resources every target is to be
+// awaited after, and verifies they do not form a cycle.
+func linkDependencies(targets []*target) error {
+	byName := map[string]*target{}
+	for _, t := range targets {
+		if t.name == "" {
+			continue
+		}
+		if _, ok := byName[t.name]; ok {
+			return fmt.Errorf("duplicate resource name: %s", t.name)
+		}
+		byName[t.name] = t
+	}
+
+	for _, t := range targets {
+		t.dependencies = nil
+		for _, name := range t.after {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("%s: unknown dependency: %s", t.label(), name)
+			}
+			t.dependencies = append(t.dependencies, dep)
+		}
+	}
+
+	_, err := sortTargets(targets)
+	return err
+}
+
+// sortTargets orders targets such that every one follows its dependencies,
+// retaining the given order otherwise. It fails if dependencies form a cycle.
+func sortTargets(targets []*target) ([]*target, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	sorted := make([]*target, 0, len(targets))
+	marks := map[*target]int{}
+	var path []string
+
+	var visit func(t *target) error
+	visit = func(t *target) error {
+		switch marks[t] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), t.label())
+		}
+		marks[t] = visiting
+		path = append(path, t.label())
+		for _, dep := range t.dependencies {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[t] = visited
+		sorted = append(sorted, t)
+		return nil
+	}
+
+	for _, t := range targets {
+		if err := visit(t); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// label identifies the target in messages, by name if given.
+func (t *target) label() string {
+	if t.name != "" {
+		return t.name
+	}
+	return t.String()
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingResource appends its name to a shared log once available.
+type recordingResource struct {
+	name  string
+	delay time.Duration
+	mu    *sync.Mutex
+	log   *[]string
+}
+
+func (r *recordingResource) String() string {
+	return r.name
+}
+
+func (r *recordingResource) Await(context.Context) error {
+	time.Sleep(r.delay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.log = append(*r.log, r.name)
+	return nil
+}
+
+func TestParseDependencies(t *testing.T) {
+	targets, err := parseTargets([]string{
+		"http://localhost/#name=web&after=db,cache",
+		"postgres://localhost/app#name=db&after=pg",
+		"postgres://localhost/#name=pg",
+		"tcp://localhost:6379#name=cache",
+	}, defaultAwaitOptions)
+	if err != nil {
+		t.Fatalf("failed to parse resources: %v", err)
+	}
+	if err := linkDependencies(targets); err != nil {
+		t.Fatalf("failed to link dependencies: %v", err)
+	}
+	if len(targets[0].dependencies) != 2 || targets[0].dependencies[1] != targets[3] {
+		t.Errorf("unexpected dependencies: %v", targets[0].dependencies)
+	}
+
+	sorted, err := sortTargets(targets)
+	if err != nil {
+		t.Fatalf("failed to sort resources: %v", err)
+	}
+	var names []string
+	for _, t := range sorted {
+		names = append(names, t.name)
+	}
+	if order := strings.Join(names, ","); order != "pg,db,cache,web" {
+		t.Errorf("unexpected order: %s", order)
+	}
+}
+
+func TestParseDependenciesFailure(t *testing.T) {
+	invalid := [][]string{
+		{"tcp://localhost:1#name=a&after=b"},
+		{"tcp://localhost:1#name=a", "tcp://localhost:2#name=a"},
+		{"tcp://localhost:1#name=a&after=a"},
+		{"tcp://localhost:1#name=a&after=c", "tcp://localhost:2#name=b&after=a", "tcp://localhost:3#name=c&after=b"},
+	}
+	for _, urlArgs := range invalid {
+		targets, err := parseTargets(urlArgs, defaultAwaitOptions)
+		if err != nil {
+			t.Fatalf("failed to parse resources: %v", err)
+		}
+		if err := linkDependencies(targets); err == nil {
+			t.Errorf("expected error linking dependencies of %v, but got none", urlArgs)
+		}
+	}
+}
+
+func TestAwaiterDependencies(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		log []string
+	)
+	targets := targetsOf(
+		&recordingResource{name: "web", mu: &mu, log: &log},
+		&recordingResource{name: "db", delay: 100 * time.Millisecond, mu: &mu, log: &log},
+		&recordingResource{name: "cache", mu: &mu, log: &log},
+	)
+	targets[0].after = []string{"db"}
+	targets[1].name = "db"
+	if err := linkDependencies(targets); err != nil {
+		t.Fatalf("failed to link dependencies: %v", err)
+	}
+
+	for _, sequential := range []bool{false, true} {
+		log = nil
+		awaiter := &awaiter{timeout: time.Second, sequential: sequential}
+		if _, err := awaiter.run(targets); err != nil {
+			t.Fatalf("failed to await resources: %v", err)
+		}
+		expected := "cache,db,web"
+		if sequential {
+			expected = "db,web,cache"
+		}
+		if order := strings.Join(log, ","); order != expected {
+			t.Errorf("unexpected order (sequential: %v): expected %s, got %s", sequential, expected, order)
+		}
+	}
+}
+
+func TestAwaiterUnavailableDependency(t *testing.T) {
+	targets := targetsOf(
+		&fakeResource{name: "db", failures: 100},
+		&fakeResource{name: "web"},
+	)
+	targets[0].name = "db"
+	targets[1].after = []string{"db"}
+	if err := linkDependencies(targets); err != nil {
+		t.Fatalf("failed to link dependencies: %v", err)
+	}
+
+	awaiter := &awaiter{timeout: 200 * time.Millisecond}
+	statuses, err := awaiter.run(targets)
+	if err == nil {
+		t.Fatal("expected resources to be unavailable")
+	}
+	if statuses[1].Attempts != 0 || !strings.Contains(statuses[1].LatestErr.Error(), "waiting for dependency: db") {
+		t.Errorf("unexpected status of dependent resource: %+v", statuses[1])
+	}
+}
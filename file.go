@@ -32,11 +32,16 @@ type fileResource struct {
 	url.URL
 }
 
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (r *fileResource) String() string {
+	return redactURL(r.URL)
+}
+
 func (r *fileResource) Await(context.Context) error {
 	// Unify absolute and relative file paths
 	filePath := filepath.Join(r.URL.Host, r.URL.Path)
 
-	opts := parseFragment(r.URL.Fragment)
+	opts := parseFragment(r.URL.EscapedFragment())
 
 	_, err := os.Stat(filePath)
 	if _, ok := opts["absent"]; ok {
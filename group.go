@@ -0,0 +1,175 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	anyGroupPrefix    = "any:"
+	quorumGroupSuffix = "-of:"
+	groupSeparator    = "|"
+)
+
+// groupResource is a logical resource consisting of several members, e.g.
+// replicas of a service. It is available once at least min of its members are
+// available.
+type groupResource struct {
+	members []resource
+	min     int
+}
+
+// memberResult is the outcome of awaiting a single member of a group.
+type memberResult struct {
+	index int
+	err   error
+}
+
+// String implements the fmt.Stringer interface.
+func (g *groupResource) String() string {
+	members := make([]string, len(g.members))
+	for i, m := range g.members {
+		members[i] = m.String()
+	}
+	quantifier := "any"
+	if g.min > 1 {
+		quantifier = strconv.Itoa(g.min)
+	}
+	return fmt.Sprintf("%s of (%s)", quantifier, strings.Join(members, ", "))
+}
+
+// Await awaits all members concurrently and returns as soon as enough of them
+// are available, or as soon as this became impossible.
+func (g *groupResource) Await(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan memberResult, len(g.members))
+	for i, m := range g.members {
+		i, m := i, m
+		go func() {
+			results <- memberResult{i, m.Await(ctx)}
+		}()
+	}
+
+	errs := make([]error, len(g.members))
+	finished := make([]bool, len(g.members))
+	var available, failed, permanent int
+	for available < g.min && len(g.members)-failed >= g.min {
+		r := <-results
+		finished[r.index] = true
+		if r.err == nil {
+			available++
+			continue
+		}
+		errs[r.index] = r.err
+		failed++
+		if classify(r.err).permanent() {
+			permanent++
+		}
+	}
+	if available >= g.min {
+		return nil
+	}
+
+	// Describe the state of every member, as the errors of single members
+	// are hidden otherwise.
+	states := make([]string, len(g.members))
+	for i, m := range g.members {
+		switch {
+		case !finished[i]:
+			states[i] = fmt.Sprintf("%s: not finished", m)
+		case errs[i] == nil:
+			states[i] = fmt.Sprintf("%s: available", m)
+		default:
+			states[i] = fmt.Sprintf("%s: %v", m, errs[i])
+		}
+	}
+	reason := fmt.Sprintf("%d of %d members available, %d required (%s)",
+		available, len(g.members), g.min, strings.Join(states, "; "))
+
+	// Keep the class of a permanent error if it prevents enough members from
+	// becoming available by retrying.
+	if len(g.members)-permanent < g.min {
+		for _, err := range errs {
+			if err != nil && classify(err).permanent() {
+				return fmt.Errorf("%s: %w", reason, err)
+			}
+		}
+	}
+	return &unavailabilityError{fmt.Errorf("%s", reason)}
+}
+
+// isGroup reports whether a resource argument denotes a group, given as
+// `any:<res>|<res>...` or `<n>-of:<res>|<res>...`.
+func isGroup(arg string) bool {
+	if strings.HasPrefix(arg, anyGroupPrefix) {
+		return true
+	}
+	quantifier, _, ok := strings.Cut(arg, quorumGroupSuffix)
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(quantifier)
+	return err == nil
+}
+
+// parseGroup parses a group of resources given as `any:<res>|<res>...` or
+// `<n>-of:<res>|<res>...`.
+func parseGroup(arg string) (*groupResource, error) {
+	min := 1
+	members := strings.TrimPrefix(arg, anyGroupPrefix)
+	if members == arg {
+		quantifier, rest, _ := strings.Cut(arg, quorumGroupSuffix)
+		n, err := strconv.Atoi(quantifier)
+		if err != nil {
+			return nil, err
+		}
+		min, members = n, rest
+	}
+	return newGroup(strings.Split(members, groupSeparator), min)
+}
+
+// newGroup parses the members of a group.
+func newGroup(urlArgs []string, min int) (*groupResource, error) {
+	if len(urlArgs) == 0 || urlArgs[0] == "" {
+		return nil, fmt.Errorf("group without members")
+	}
+	if min < 1 || min > len(urlArgs) {
+		return nil, fmt.Errorf("invalid group quorum: %d of %d members required", min, len(urlArgs))
+	}
+	members, err := parseTargets(urlArgs, defaultAwaitOptions)
+	if err != nil {
+		return nil, err
+	}
+	g := &groupResource{min: min}
+	for _, m := range members {
+		if _, ok := m.resource.(*groupResource); ok {
+			return nil, fmt.Errorf("nested groups are not supported")
+		}
+		g.members = append(g.members, m.resource)
+	}
+	return g, nil
+}
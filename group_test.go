@@ -0,0 +1,120 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGroup(t *testing.T) {
+	tests := map[string]int{
+		"any:tcp://localhost:1|tcp://localhost:2":                     1,
+		"2-of:kafka://k1:9092|kafka://k2:9092|kafka://k3:9092#topics": 2,
+	}
+	for given, expected := range tests {
+		targets, err := parseTargets([]string{given}, defaultAwaitOptions)
+		if err != nil {
+			t.Errorf("failed to parse group '%s': %v", given, err)
+			continue
+		}
+		g, ok := targets[0].resource.(*groupResource)
+		if !ok {
+			t.Errorf("expected group, got %T", targets[0].resource)
+			continue
+		}
+		if g.min != expected || len(g.members) != strings.Count(given, "|")+1 {
+			t.Errorf("unexpected group of '%s': %s", given, g)
+		}
+	}
+}
+
+func TestParseGroupFailure(t *testing.T) {
+	invalid := []string{
+		"any:",
+		"3-of:tcp://localhost:1|tcp://localhost:2",
+		"0-of:tcp://localhost:1",
+		"any:tcp://localhost:1|unknown://localhost",
+	}
+	for _, given := range invalid {
+		if _, err := parseTargets([]string{given}, defaultAwaitOptions); err == nil {
+			t.Errorf("expected error parsing invalid group '%s', but got none", given)
+		}
+	}
+}
+
+func TestGroupAwaitAny(t *testing.T) {
+	g := &groupResource{
+		members: []resource{
+			&hangingResource{},
+			&fakeResource{name: "fast"},
+		},
+		min: 1,
+	}
+	if err := g.Await(context.Background()); err != nil {
+		t.Errorf("expected group to be available, got: %v", err)
+	}
+}
+
+func TestGroupAwaitQuorum(t *testing.T) {
+	g := &groupResource{
+		members: []resource{
+			&fakeResource{name: "up"},
+			&fakeResource{name: "down", failures: 1},
+			&fakeResource{name: "slow", delay: time.Minute},
+		},
+		min: 2,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := g.Await(ctx)
+	var unavailableErr *unavailabilityError
+	if !errors.As(err, &unavailableErr) {
+		t.Fatalf("expected unavailability error, got: %v", err)
+	}
+	for _, expected := range []string{"1 of 3 members available, 2 required", "up: available", "down: not yet"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain '%s', got: %v", expected, err)
+		}
+	}
+}
+
+func TestGroupAwaitPermanent(t *testing.T) {
+	g := &groupResource{
+		members: []resource{
+			&sequenceResource{results: []error{&resourceConfigError{errors.New("invalid")}}},
+			&fakeResource{name: "up"},
+		},
+		min: 2,
+	}
+	if err := g.Await(context.Background()); classify(err) != configClass {
+		t.Errorf("expected config error, got: %v", err)
+	}
+
+	g.min = 1
+	if err := g.Await(context.Background()); err != nil {
+		t.Errorf("expected group to be available, got: %v", err)
+	}
+}
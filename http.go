@@ -21,59 +21,314 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
 )
 
+// methodPattern matches valid HTTP methods, i.e. tokens as defined by RFC 7230.
+var methodPattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
 type httpResource struct {
 	url.URL
+	method  string
+	headers http.Header
+	body    string
+	// status lists the accepted status codes, see statusAccepted.
+	status []string
+	// assertions must all hold for the body of the response.
+	assertions []bodyAssertion
+	// followRedirects is whether redirect responses are followed, rather than
+	// being taken as the response.
+	followRedirects bool
+	// proxy selects the proxy of requests, nil to connect directly.
+	proxy func(*http.Request) (*url.URL, error)
+	// protocol is the HTTP version to use, see the supported values below.
+	protocol string
 }
 
-func (r *httpResource) Await(ctx context.Context) error {
-	var client *http.Client
+// Supported values of the 'protocol' option.
+const (
+	autoProtocol  = "auto"
+	http1Protocol = "http/1.1"
+	http2Protocol = "h2"
+	h2cProtocol   = "h2c"
+)
+
+// maxBodySize limits how much of a response body is read for assertions.
+const maxBodySize = 1 << 20
+
+// bodyAssertion checks the body of a response, returning an error explaining
+// a mismatch.
+type bodyAssertion func(body []byte) error
+
+func newHTTPResource(u url.URL) (resource, error) {
+	r := &httpResource{
+		URL:     u,
+		method:  strings.ToUpper(getOptOrDefault(u, "method", http.MethodGet)),
+		headers: http.Header{},
+		body:    getOptOrDefault(u, "body", ""),
+	}
+	if !methodPattern.MatchString(r.method) {
+		return nil, &resourceConfigError{
+			Reason: fmt.Errorf("%v: invalid value for 'method' configuration: %v", redactURL(u), r.method),
+		}
+	}
+	for _, header := range parseFragment(u.EscapedFragment())["header"] {
+		name, val, ok := strings.Cut(header, ":")
+		if name = strings.TrimSpace(name); !ok || !methodPattern.MatchString(name) {
+			return nil, &resourceConfigError{
+				Reason: fmt.Errorf("%v: invalid value for 'header' configuration, expected <name>:<value>: %v", redactURL(u), redact(header)),
+			}
+		}
+		r.headers.Add(name, strings.TrimSpace(val))
+	}
+	r.status = strings.Split(getOptOrDefault(u, "status", "2xx"), ",")
+	for i, status := range r.status {
+		status = strings.ToLower(strings.TrimSpace(status))
+		r.status[i] = status
+		if !validStatus(status) {
+			return nil, &resourceConfigError{
+				Reason: fmt.Errorf("%v: invalid value for 'status' configuration, expected code, class like 2xx or 'any': %v", redactURL(u), status),
+			}
+		}
+	}
+	if err := r.parseAssertions(); err != nil {
+		return nil, &resourceConfigError{fmt.Errorf("%v: %v", redactURL(u), err)}
+	}
+	if err := r.parseTransportOptions(); err != nil {
+		return nil, &resourceConfigError{fmt.Errorf("%v: %v", redactURL(u), err)}
+	}
+	return r, nil
+}
+
+func (r *httpResource) parseTransportOptions() error {
+	switch redirect := getOptOrDefault(r.URL, "redirect", "follow"); redirect {
+	case "follow":
+		r.followRedirects = true
+	case "none":
+	default:
+		return fmt.Errorf("unknown value for 'redirect' configuration: %v", redirect)
+	}
+
+	proxy := getOptOrDefault(r.URL, "proxy", "env")
+	switch proxy {
+	case "env":
+		r.proxy = http.ProxyFromEnvironment
+	case "none":
+	default:
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("invalid value for 'proxy' configuration, expected 'env', 'none' or URL: %v", redact(proxy))
+		}
+		r.proxy = http.ProxyURL(proxyURL)
+	}
 
-	if skipTLSVerification(r) {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	r.protocol = getOptOrDefault(r.URL, "protocol", autoProtocol)
+	switch r.protocol {
+	case autoProtocol, http1Protocol:
+	case http2Protocol:
+		if r.URL.Scheme != "https" {
+			return fmt.Errorf("'protocol=%s' requires https, use %s for HTTP/2 without TLS", http2Protocol, h2cProtocol)
+		}
+	case h2cProtocol:
+		if r.URL.Scheme != "http" {
+			return fmt.Errorf("'protocol=%s' requires http, use %s for HTTP/2 over TLS", h2cProtocol, http2Protocol)
+		}
+		if proxy != "env" && proxy != "none" {
+			return fmt.Errorf("'protocol=%s' does not support proxies", h2cProtocol)
 		}
-		client = &http.Client{Transport: tr}
-	} else {
-		client = &http.Client{}
+	default:
+		return fmt.Errorf("unknown value for 'protocol' configuration: %v", r.protocol)
 	}
+	return nil
+}
 
-	// IDEA(uwe): Use fragment to set method
+func (r *httpResource) parseAssertions() error {
+	opts := parseFragment(r.URL.EscapedFragment())
+	for _, substr := range opts["body-contains"] {
+		substr := substr
+		r.assertions = append(r.assertions, func(body []byte) error {
+			if !bytes.Contains(body, []byte(substr)) {
+				return fmt.Errorf("body does not contain %q", substr)
+			}
+			return nil
+		})
+	}
+	for _, expr := range opts["body-regex"] {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid value for 'body-regex' configuration: %v", err)
+		}
+		r.assertions = append(r.assertions, func(body []byte) error {
+			if !re.Match(body) {
+				return fmt.Errorf("body does not match %q", re)
+			}
+			return nil
+		})
+	}
+	for _, expr := range opts["body-json"] {
+		a, err := parseJSONAssertion(expr)
+		if err != nil {
+			return fmt.Errorf("invalid value for 'body-json' configuration: %v", err)
+		}
+		r.assertions = append(r.assertions, a.check)
+	}
+	return nil
+}
 
-	req, err := http.NewRequest("GET", r.URL.String(), nil)
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (r *httpResource) String() string {
+	return redactURL(r.URL)
+}
+
+// client returns a client for a single attempt, along with a function
+// releasing its connections.
+func (r *httpResource) client(ctx context.Context) (*http.Client, func(), error) {
+	client := &http.Client{}
+	if !r.followRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	if r.protocol == h2cProtocol {
+		// HTTP/2 with prior knowledge, dialing plain connections in place of
+		// TLS ones
+		dialer := &net.Dialer{}
+		transport := &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}
+		client.Transport = transport
+		return client, transport.CloseIdleConnections, nil
+	}
+
+	tlsConfig, err := tlsConfigOf(r.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = r.proxy
+	switch r.protocol {
+	case http1Protocol:
+		// A non-nil, empty map disables HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case http2Protocol:
+		transport.ForceAttemptHTTP2 = true
+	}
+	client.Transport = transport
+	return client, transport.CloseIdleConnections, nil
+}
+
+func (r *httpResource) Await(ctx context.Context) error {
+	client, closeIdle, err := r.client(ctx)
 	if err != nil {
 		return err
 	}
+	defer closeIdle()
 
-	// IDEA(uwe): Use k/v pairs in fragment to set headers
+	var reqBody io.Reader
+	if r.body != "" {
+		reqBody = strings.NewReader(r.body)
+	}
+	// The fragment holds options, not to be sent nor to show up in errors
+	reqURL := r.URL
+	reqURL.Fragment, reqURL.RawFragment = "", ""
+	req, err := http.NewRequest(r.method, reqURL.String(), reqBody)
+	if err != nil {
+		return err
+	}
 
 	req = req.WithContext(ctx)
 
 	req.Header.Set("User-Agent", "await/"+version)
+	for name, vals := range r.headers {
+		if name == "Host" {
+			// Go ignores the header in favour of the field
+			req.Host = vals[0]
+			continue
+		}
+		req.Header[name] = vals
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			if u, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+				urlErr.URL = redactURL(*u)
+			}
+		}
 		return &unavailabilityError{err}
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	// IDEA(uwe): Use fragment to set tolerated status code
+	if r.protocol == http2Protocol && resp.ProtoMajor != 2 {
+		return &unavailabilityError{fmt.Errorf("unexpected protocol %s, expected HTTP/2", resp.Proto)}
+	}
+	if !r.statusAccepted(resp.StatusCode) {
+		return &unavailabilityError{fmt.Errorf("unexpected status %s, expected %s", resp.Status, strings.Join(r.status, ", "))}
+	}
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+	if len(r.assertions) == 0 {
 		return nil
 	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return &unavailabilityError{fmt.Errorf("failed to read body: %v", err)}
+	}
+	for _, assert := range r.assertions {
+		if err := assert(body); err != nil {
+			return &unavailabilityError{err}
+		}
+	}
+	return nil
+}
 
-	return &unavailabilityError{errors.New(resp.Status)}
+// statusAccepted reports whether the status code matches any of the accepted
+// ones, given as code (e.g. `200`), class (e.g. `3xx`) or `any`.
+func (r *httpResource) statusAccepted(code int) bool {
+	for _, status := range r.status {
+		switch {
+		case status == "any":
+			return true
+		case strings.HasSuffix(status, "xx"):
+			if code/100 == int(status[0]-'0') {
+				return true
+			}
+		case status == strconv.Itoa(code):
+			return true
+		}
+	}
+	return false
 }
 
-func skipTLSVerification(r *httpResource) bool {
-	opts := parseFragment(r.URL.Fragment)
-	vals, ok := opts["tls"]
-	return ok && r.URL.Scheme == "https" && len(vals) == 1 && vals[0] == "skip-verify"
+// validStatus reports whether an accepted status is given as code in the
+// range 100-599, class from 1xx to 5xx or `any`.
+func validStatus(status string) bool {
+	if status == "any" {
+		return true
+	}
+	if len(status) == 3 && strings.HasSuffix(status, "xx") {
+		return status[0] >= '1' && status[0] <= '5'
+	}
+	code, err := strconv.Atoi(status)
+	return err == nil && code >= 100 && code <= 599
 }
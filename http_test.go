@@ -33,16 +33,24 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func TestTLSSkipVerify(t *testing.T) {
 	shutdownServer := setupHttpsServer(t, "55372")
 	defer shutdownServer()
 
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
 	resources, _ := parseResources([]string{
 		"https://localhost:55372",
@@ -58,6 +66,303 @@ func TestTLSSkipVerify(t *testing.T) {
 	}
 }
 
+func TestHTTPRequestOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Host != "api.local" || r.Header.Get("Authorization") != "Bearer s3cr3t" ||
+			r.Header.Get("X-Trace") != "a, b" || string(body) != `{"ping":true}` {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "unexpected request: %s %s %v %s", r.Method, r.Host, r.Header, body)
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fragment := url.Values{
+		"method": {"post"},
+		"header": {"Authorization: Bearer s3cr3t", "X-Trace:a, b", "Host:api.local"},
+		"body":   {`{"ping":true}`},
+	}
+	res, err := parseResource(server.URL + "#" + fragment.Encode())
+	if err != nil {
+		t.Fatalf("failed to parse resource: %v", err)
+	}
+	if err := res.Await(ctx); err != nil {
+		t.Errorf("expected resource to be available, got: %v", err)
+	}
+	if strings.Contains(res.String(), "s3cr3t") {
+		t.Errorf("expected Authorization header to be redacted: %s", res)
+	}
+
+	res, _ = parseResource(server.URL)
+	if err := res.Await(ctx); err == nil {
+		t.Error("expected plain GET request to be rejected")
+	}
+}
+
+func TestHTTPRequestOptionsEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("Authorization"), r.Header.Get("X-Query"), body)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := map[string]string{
+		"header=Authorization:Basic%20YT%2Bb%3D%3D":    "Basic YT+b==|",
+		"header=Authorization:Basic+YT%2Bb":            "Basic YT+b|",
+		"header=X-Query:a%3Db%26c%3Dd":                 "|a=b&c=d",
+		"method=POST&body=a%26b%3Dc%2Bd":               "||a&b=c+d",
+		"method=POST&body=%7B%22q%22%3A%22a%2Bb%22%7D": `||{"q":"a+b"}`,
+		"method=POST&body=100%25&header=X-Query:50%25": "|50%|100%",
+	}
+	for fragment, expected := range tests {
+		res, err := parseResource(server.URL + "#" + fragment + "&body-contains=" + url.QueryEscape(expected))
+		if err != nil {
+			t.Errorf("failed to parse resource '%s': %v", fragment, err)
+			continue
+		}
+		if err := res.Await(ctx); err != nil {
+			t.Errorf("unexpected request of '%s': %v", fragment, err)
+		}
+	}
+}
+
+func TestHTTPErrorRedacted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := parseResource("http://localhost:1/?token=tk1#header=X-Api-Key:abc123")
+	if err != nil {
+		t.Fatalf("failed to parse resource: %v", err)
+	}
+	err = res.Await(ctx)
+	if err == nil {
+		t.Fatal("expected request to fail")
+	}
+	if msg := err.Error(); strings.Contains(msg, "tk1") || strings.Contains(msg, "abc123") || strings.Contains(msg, "#") {
+		t.Errorf("expected error without secrets and fragment, got: %s", msg)
+	}
+}
+
+func TestHTTPRequestOptionsFailure(t *testing.T) {
+	invalid := []string{
+		"http://localhost/#method=GET%20/",
+		"http://localhost/#header=Authorization",
+		"http://localhost/#header=:value",
+	}
+	for _, urlString := range invalid {
+		if _, err := parseResource(urlString); err == nil {
+			t.Errorf("expected error parsing invalid resource '%v', but got none", urlString)
+		}
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := map[string]bool{
+		"/200":                     true,
+		"/204":                     true,
+		"/401":                     false,
+		"/401#status=200,401":      true,
+		"/304#status=3xx":          true,
+		"/304#status=200,3XX":      true,
+		"/503#status=2xx,4xx":      false,
+		"/503#status=any":          true,
+		"/500#status=200%2C%20500": true,
+	}
+	for path, expected := range tests {
+		res, err := parseResource(server.URL + path)
+		if err != nil {
+			t.Errorf("failed to parse resource '%s': %v", path, err)
+			continue
+		}
+		err = res.Await(ctx)
+		if expected && err != nil {
+			t.Errorf("expected '%s' to be available, got: %v", path, err)
+		} else if !expected && err == nil {
+			t.Errorf("expected '%s' to be unavailable", path)
+		}
+	}
+
+	res, _ := parseResource(server.URL + "/503#status=200,3xx")
+	expected := "unexpected status 503 Service Unavailable, expected 200, 3xx"
+	if err := res.Await(ctx); err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected '%s', got: %v", expected, err)
+	}
+
+	for _, status := range []string{"600", "6xx", "x", "2x"} {
+		if _, err := parseResource("http://localhost/#status=" + status); err == nil {
+			t.Errorf("expected error parsing invalid status '%s', but got none", status)
+		}
+	}
+}
+
+func TestHTTPBodyAssertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"status":"DOWN","components":{"db":{"status":"UP"}}}`)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := map[string]string{
+		"body-contains=DOWN":                     "",
+		"body-contains=UP&body-contains=OUT":     `body does not contain "OUT"`,
+		"body-regex=status.%3A.(UP%7CDOWN)":      "",
+		"body-regex=%5EUP":                       `body does not match "^UP"`,
+		`body-json=$.components.db.status=="UP"`: "",
+		`body-json=$.status == "UP"`:             `$.status is "DOWN", expected == "UP"`,
+	}
+	for fragment, expected := range tests {
+		res, err := parseResource(server.URL + "#" + strings.ReplaceAll(fragment, " ", "%20"))
+		if err != nil {
+			t.Errorf("failed to parse resource '%s': %v", fragment, err)
+			continue
+		}
+		err = res.Await(ctx)
+		if expected == "" && err != nil {
+			t.Errorf("expected '%s' to hold, got: %v", fragment, err)
+		} else if expected != "" && (err == nil || err.Error() != expected) {
+			t.Errorf("unexpected error of '%s': expected '%s', got: %v", fragment, expected, err)
+		}
+	}
+
+	for _, fragment := range []string{"body-regex=(", "body-json=$.status%20==%20UP"} {
+		if _, err := parseResource(server.URL + "#" + fragment); err == nil {
+			t.Errorf("expected error parsing invalid assertion '%s', but got none", fragment)
+		}
+	}
+}
+
+func TestHTTPRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := map[string]bool{
+		"/health":                          true,
+		"/health#redirect=follow":          true,
+		"/health#redirect=none":            false,
+		"/health#redirect=none&status=3xx": true,
+		"/login#redirect=none":             true,
+	}
+	for path, expected := range tests {
+		res, err := parseResource(server.URL + path)
+		if err != nil {
+			t.Errorf("failed to parse resource '%s': %v", path, err)
+			continue
+		}
+		err = res.Await(ctx)
+		if expected && err != nil {
+			t.Errorf("expected '%s' to be available, got: %v", path, err)
+		} else if !expected && err == nil {
+			t.Errorf("expected '%s' to be unavailable", path)
+		}
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Proxied requests are given the absolute URL
+		if r.URL.Host != "upstream.invalid" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer proxy.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The proxy of the environment is cached on first use, so only explicit
+	// proxies can be tested.
+	res, _ := parseResource("http://upstream.invalid/#proxy=" + url.QueryEscape(proxy.URL))
+	if err := res.Await(ctx); err != nil {
+		t.Errorf("expected request to pass the given proxy, got: %v", err)
+	}
+	res, _ = parseResource("http://upstream.invalid/#proxy=none")
+	if err := res.Await(ctx); err == nil {
+		t.Error("expected request bypassing the proxy to fail")
+	}
+}
+
+func TestHTTPProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := r.URL.Query().Get("proto"); want != "" && r.Proto != want {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		}
+	})
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	http1Server := httptest.NewTLSServer(handler)
+	defer http1Server.Close()
+	h2cServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer h2cServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := map[string]bool{
+		tlsServer.URL + "/?proto=HTTP/2.0#tls=skip-verify":                   true,
+		tlsServer.URL + "/?proto=HTTP/2.0#tls=skip-verify&protocol=h2":       true,
+		tlsServer.URL + "/?proto=HTTP/1.1#tls=skip-verify&protocol=http/1.1": true,
+		http1Server.URL + "/#tls=skip-verify":                                true,
+		http1Server.URL + "/#tls=skip-verify&protocol=h2":                    false,
+		h2cServer.URL + "/?proto=HTTP/1.1":                                   true,
+		h2cServer.URL + "/?proto=HTTP/2.0#protocol=h2c":                      true,
+	}
+	for urlString, expected := range tests {
+		res, err := parseResource(urlString)
+		if err != nil {
+			t.Errorf("failed to parse resource '%s': %v", urlString, err)
+			continue
+		}
+		err = res.Await(ctx)
+		if expected && err != nil {
+			t.Errorf("expected '%s' to be available, got: %v", urlString, err)
+		} else if !expected && err == nil {
+			t.Errorf("expected '%s' to be unavailable", urlString)
+		}
+	}
+}
+
+func TestHTTPTransportOptionsFailure(t *testing.T) {
+	invalid := []string{
+		"http://localhost/#redirect=never",
+		"http://localhost/#proxy=proxy",
+		"http://localhost/#protocol=http/3",
+		"http://localhost/#protocol=h2",
+		"https://localhost/#protocol=h2c",
+		"http://localhost/#protocol=h2c&proxy=http://proxy:3128",
+	}
+	for _, urlString := range invalid {
+		if _, err := parseResource(urlString); err == nil {
+			t.Errorf("expected error parsing invalid resource '%v', but got none", urlString)
+		}
+	}
+}
+
 func setupHttpServer(t *testing.T, port string) func() {
 	server, ln := createServer(t, port)
 
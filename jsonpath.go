@@ -0,0 +1,197 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// jsonOperators are the supported comparison operators, longest first for
+// parsing.
+var jsonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// jsonAssertion asserts on a value within a JSON document, given as JSONPath
+// expression like `$.status == "UP"`. Supported are member (`.key` or
+// `['key']`) and array index (`[0]`) selectors, optionally compared to a JSON
+// value. Without comparison, the value must merely exist.
+type jsonAssertion struct {
+	path string
+	// selectors holds member names as string and array indices as int.
+	selectors []interface{}
+	operator  string
+	value     interface{}
+	// expected describes the comparison, e.g. `== "UP"`.
+	expected string
+}
+
+func parseJSONAssertion(expr string) (*jsonAssertion, error) {
+	a := &jsonAssertion{path: strings.TrimSpace(expr)}
+
+	if i, op := indexOperator(expr); i >= 0 {
+		val := strings.TrimSpace(expr[i+len(op):])
+		a.path, a.operator, a.expected = strings.TrimSpace(expr[:i]), op, op+" "+val
+		if err := json.Unmarshal([]byte(val), &a.value); err != nil {
+			return nil, fmt.Errorf("invalid value, expected JSON like \"UP\" or 42: %v", err)
+		}
+		if _, ok := a.value.(float64); !ok && op != "==" && op != "!=" {
+			return nil, fmt.Errorf("operator %s requires a number", op)
+		}
+	}
+
+	// Allow omitting the root, the same as gjson
+	path := a.path
+	if !strings.HasPrefix(path, "$") {
+		path = "$." + path
+	}
+	selectors, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	a.selectors = selectors
+	return a, nil
+}
+
+// indexOperator returns the position of the first operator outside of quotes,
+// -1 if there is none.
+func indexOperator(expr string) (int, string) {
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			for _, op := range jsonOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					return i, op
+				}
+			}
+		}
+	}
+	return -1, ""
+}
+
+func parseJSONPath(path string) ([]interface{}, error) {
+	var selectors []interface{}
+	rest := strings.TrimPrefix(path, "$")
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("invalid path %s: empty member name", path)
+			}
+			selectors = append(selectors, name)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %s: missing ]", path)
+			}
+			sel := rest[1:end]
+			if len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0] {
+				selectors = append(selectors, sel[1:len(sel)-1])
+			} else if index, err := strconv.Atoi(sel); err == nil && index >= 0 {
+				selectors = append(selectors, index)
+			} else {
+				return nil, fmt.Errorf("invalid path %s: unsupported selector [%s]", path, sel)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %s: unexpected %q", path, rest[0])
+		}
+	}
+	return selectors, nil
+}
+
+// check evaluates the assertion against a JSON document, returning an error
+// explaining a mismatch.
+func (a *jsonAssertion) check(doc []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	for _, sel := range a.selectors {
+		var ok bool
+		switch s := sel.(type) {
+		case string:
+			var obj map[string]interface{}
+			if obj, ok = v.(map[string]interface{}); ok {
+				v, ok = obj[s]
+			}
+		case int:
+			var arr []interface{}
+			if arr, ok = v.([]interface{}); ok && s < len(arr) {
+				v = arr[s]
+			} else {
+				ok = false
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s not found in body", a.path)
+		}
+	}
+
+	if a.operator == "" || a.compare(v) {
+		return nil
+	}
+	actual, _ := json.Marshal(v)
+	return fmt.Errorf("%s is %s, expected %s", a.path, actual, a.expected)
+}
+
+func (a *jsonAssertion) compare(v interface{}) bool {
+	switch a.operator {
+	case "==":
+		return reflect.DeepEqual(v, a.value)
+	case "!=":
+		return !reflect.DeepEqual(v, a.value)
+	}
+	actual, ok := v.(float64)
+	if !ok {
+		return false
+	}
+	expected := a.value.(float64)
+	switch a.operator {
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	default:
+		return false
+	}
+}
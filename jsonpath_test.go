@@ -0,0 +1,93 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestJSONAssertion(t *testing.T) {
+	doc := []byte(`{
+		"status": "UP",
+		"components": {"db": {"status": "DOWN", "details": {"connections": 3}}},
+		"checks": [{"name": "disk", "ok": true}],
+		"weird key": null
+	}`)
+
+	tests := map[string]bool{
+		`$.status == "UP"`:                         true,
+		`status == "UP"`:                           true,
+		`$.status != "UP"`:                         false,
+		`$.components.db.status == "UP"`:           false,
+		`$['components']["db"].status == "DOWN"`:   true,
+		`$.components.db.details.connections >= 3`: true,
+		`$.components.db.details.connections < 3`:  false,
+		`$.checks[0].ok == true`:                   true,
+		`$.checks[1]`:                              false,
+		`$['weird key'] == null`:                   true,
+		`$.status`:                                 true,
+		`$.missing`:                                false,
+		`$.status == "a == b"`:                     false,
+		`$.components == {"db": {"status": "DOWN", "details": {"connections": 3}}}`: true,
+	}
+	for expr, expected := range tests {
+		a, err := parseJSONAssertion(expr)
+		if err != nil {
+			t.Errorf("failed to parse '%s': %v", expr, err)
+			continue
+		}
+		if err := a.check(doc); expected && err != nil {
+			t.Errorf("expected '%s' to hold, got: %v", expr, err)
+		} else if !expected && err == nil {
+			t.Errorf("expected '%s' not to hold", expr)
+		}
+	}
+}
+
+func TestJSONAssertionMismatch(t *testing.T) {
+	a, err := parseJSONAssertion(`$.status == "UP"`)
+	if err != nil {
+		t.Fatalf("failed to parse assertion: %v", err)
+	}
+	expected := `$.status is "DOWN", expected == "UP"`
+	if err := a.check([]byte(`{"status":"DOWN"}`)); err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected '%s', got: %v", expected, err)
+	}
+	if err := a.check([]byte(`<html>`)); err == nil {
+		t.Error("expected error checking invalid JSON, but got none")
+	}
+}
+
+func TestParseJSONAssertionFailure(t *testing.T) {
+	invalid := []string{
+		`$.status == UP`,
+		`$.status > "UP"`,
+		`$..status`,
+		`$.checks[x]`,
+		`$.checks[0`,
+		`$status`,
+	}
+	for _, expr := range invalid {
+		if _, err := parseJSONAssertion(expr); err == nil {
+			t.Errorf("expected error parsing invalid assertion '%s', but got none", expr)
+		}
+	}
+}
@@ -37,6 +37,11 @@ type kafkaResource struct {
 	url.URL
 }
 
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (r *kafkaResource) String() string {
+	return redactURL(r.URL)
+}
+
 // Ensures that misconfigured Kafka Resources are not possible
 func newKafkaResource(u url.URL) (resource, error) {
 	if len(u.Port()) == 0 {
@@ -55,16 +60,7 @@ func newKafkaResource(u url.URL) (resource, error) {
 		break
 	default:
 		return nil, &resourceConfigError{
-			Reason: fmt.Errorf("%v: unknown value for 'sasl' configuration: %v", u.String(), mechanism),
-		}
-	}
-	tls := getOptOrDefault(u, "tls", "")
-	switch tls {
-	case "skip-verify", "":
-		break
-	default:
-		return nil, &resourceConfigError{
-			Reason: fmt.Errorf("%v: unknown value for 'tls' configuration: %v", u.String(), tls),
+			Reason: fmt.Errorf("%v: unknown value for 'sasl' configuration: %v", redactURL(u), mechanism),
 		}
 	}
 	return &kafkaResource{u}, nil
@@ -128,19 +124,27 @@ func (r *kafkaResource) dialer() (*kafka.Dialer, error) {
 	if err != nil {
 		return nil, err
 	}
+	tlsConfig, err := r.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
 	return &kafka.Dialer{
 		Timeout:       10 * time.Second,
 		DualStack:     true,
-		TLS:           r.tlsConfig(),
+		TLS:           tlsConfig,
 		SASLMechanism: mechanism,
 	}, nil
 }
 
-func (r *kafkaResource) tlsConfig() *tls.Config {
-	if r.URL.Scheme == "kafkas" {
-		return &tls.Config{InsecureSkipVerify: r.skipTLSVerification()}
+func (r *kafkaResource) tlsConfig() (*tls.Config, error) {
+	if r.URL.Scheme != "kafkas" {
+		return nil, nil
 	}
-	return nil
+	tlsConfig, err := tlsConfigOf(r.URL)
+	if tlsConfig == nil && err == nil {
+		tlsConfig = &tls.Config{}
+	}
+	return tlsConfig, err
 }
 
 func (r *kafkaResource) saslMechanism() (sasl.Mechanism, error) {
@@ -167,12 +171,8 @@ func (r *kafkaResource) getOptOrDefault(key string, defaultVal string) string {
 	return getOptOrDefault(r.URL, key, defaultVal)
 }
 
-func (r *kafkaResource) skipTLSVerification() bool {
-	return r.getOptOrDefault("tls", "verify") == "skip-verify"
-}
-
 func (r *kafkaResource) shouldWaitForTopics() (bool, []string) {
-	opts := parseFragment(r.URL.Fragment)
+	opts := parseFragment(r.URL.EscapedFragment())
 	if val, ok := opts["topics"]; ok {
 		var topics []string
 		if len(val) > 0 && val[0] != "" {
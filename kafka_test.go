@@ -260,7 +260,8 @@ func resourceAwait(t *testing.T, s string) error {
 	if err != nil {
 		t.Fatalf("Failed to parse Resource: %v.", err)
 	}
-	ctx, _ := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
 	return resource.Await(ctx)
 }
 
@@ -272,7 +273,8 @@ func ensurePortClosed(t *testing.T, port string) {
 }
 
 func ensureKafkaAvailable(t *testing.T) *kafka.Conn {
-	ctx, _ := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
 	conn, err := kafka.DialContext(ctx, "tcp", "localhost:9092")
 	if err != nil {
 		t.Skipf("No kafka available for testing (%v), skipping.", err)
@@ -281,7 +283,8 @@ func ensureKafkaAvailable(t *testing.T) *kafka.Conn {
 }
 
 func ensureKafkaTLSAvailable(t *testing.T) *kafka.Conn {
-	ctx, _ := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
 	dialer := &kafka.Dialer{
 		TLS: &tls.Config{InsecureSkipVerify: true},
 	}
@@ -293,7 +296,8 @@ func ensureKafkaTLSAvailable(t *testing.T) *kafka.Conn {
 }
 
 func ensureKafkaTLSWithSASLAvailable(t *testing.T) *kafka.Conn {
-	ctx, _ := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
 	dialer := &kafka.Dialer{
 		TLS: &tls.Config{InsecureSkipVerify: true},
 	}
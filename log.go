@@ -21,6 +21,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 )
@@ -34,7 +35,8 @@ const (
 )
 
 // LevelLogger defines a logger which is aware of log levels and only logs
-// messages when below or equal to a given log level.
+// messages when below or equal to a given log level. Known secrets are
+// redacted from all messages.
 type LevelLogger struct {
 	*log.Logger
 	level int
@@ -52,7 +54,7 @@ func NewLogger(level int) *LevelLogger {
 // debugLevel.
 func (l *LevelLogger) Debug(v ...interface{}) {
 	if l.level <= debugLevel {
-		log.Print(v...)
+		log.Print(redact(fmt.Sprint(v...)))
 	}
 }
 
@@ -60,7 +62,7 @@ func (l *LevelLogger) Debug(v ...interface{}) {
 // debugLevel.
 func (l *LevelLogger) Debugln(v ...interface{}) {
 	if l.level <= debugLevel {
-		log.Println(v...)
+		log.Print(redact(fmt.Sprintln(v...)))
 	}
 }
 
@@ -68,14 +70,14 @@ func (l *LevelLogger) Debugln(v ...interface{}) {
 // debugLevel.
 func (l *LevelLogger) Debugf(format string, v ...interface{}) {
 	if l.level <= debugLevel {
-		log.Printf(format, v...)
+		log.Print(redact(fmt.Sprintf(format, v...)))
 	}
 }
 
 // Info logs a message if the current log level is below or equal to infoLevel.
 func (l *LevelLogger) Info(v ...interface{}) {
 	if l.level <= infoLevel {
-		log.Print(v...)
+		log.Print(redact(fmt.Sprint(v...)))
 	}
 }
 
@@ -83,14 +85,14 @@ func (l *LevelLogger) Info(v ...interface{}) {
 // infoLevel.
 func (l *LevelLogger) Infoln(v ...interface{}) {
 	if l.level <= infoLevel {
-		log.Println(v...)
+		log.Print(redact(fmt.Sprintln(v...)))
 	}
 }
 
 // Infof logs a message if the current log level is below or equal to infoLevel.
 func (l *LevelLogger) Infof(format string, v ...interface{}) {
 	if l.level <= infoLevel {
-		log.Printf(format, v...)
+		log.Print(redact(fmt.Sprintf(format, v...)))
 	}
 }
 
@@ -98,7 +100,7 @@ func (l *LevelLogger) Infof(format string, v ...interface{}) {
 // errorLevel.
 func (l *LevelLogger) Error(v ...interface{}) {
 	if l.level <= errorLevel {
-		log.Print(v...)
+		log.Print(redact(fmt.Sprint(v...)))
 	}
 }
 
@@ -106,7 +108,7 @@ func (l *LevelLogger) Error(v ...interface{}) {
 // errorLevel.
 func (l *LevelLogger) Errorln(v ...interface{}) {
 	if l.level <= errorLevel {
-		log.Println(v...)
+		log.Print(redact(fmt.Sprintln(v...)))
 	}
 }
 
@@ -114,7 +116,7 @@ func (l *LevelLogger) Errorln(v ...interface{}) {
 // errorLevel.
 func (l *LevelLogger) Errorf(format string, v ...interface{}) {
 	if l.level <= errorLevel {
-		log.Printf(format, v...)
+		log.Print(redact(fmt.Sprintf(format, v...)))
 	}
 }
 
@@ -22,10 +22,13 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
 	"syscall"
 	"time"
@@ -33,18 +36,52 @@ import (
 
 const version = "1.3.1"
 
+// Exit codes of await, also documented in the README.
+const (
+	exitOK          = 0
+	exitUnavailable = 1   // Timeout exceeded before all resources were available
+	exitConfig      = 2   // Invalid flags, configuration or resource definitions
+	exitPermanent   = 3   // A resource failed permanently, e.g. rejected credentials
+	exitCmdFailed   = 126 // Command found, but could not be executed
+	exitCmdNotFound = 127 // Command not found
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == checkCommand {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+
 	var (
-		forceFlag    = flag.Bool("f", false, "Force running the command even after giving up")
-		infileFlag   = flag.String("i", "", "Read resources from file, '-' to read from stdin")
-		quietFlag    = flag.Bool("q", false, "Set quiet mode")
-		timeoutFlag  = flag.Duration("t", 1*time.Minute, "Set timeout duration before giving up")
-		verbose1Flag = flag.Bool("v", false, "Set verbose output mode")
-		verbose2Flag = flag.Bool("vv", false, "Set more verbose output mode")
-		versionFlag  = flag.Bool("V", false, "Show version")
+		configFlag     = flag.String("c", "", "Read resources and options from YAML or JSON configuration file, '-' to read from stdin")
+		attemptFlag    = flag.Duration("attempt-timeout", 0, "Set timeout duration of a single attempt, 0 for no limit")
+		failFastFlag   = flag.Bool("fail-fast", defaultAwaitOptions.failFast, "Give up as soon as a resource fails permanently, e.g. due to rejected credentials")
+		forceFlag      = flag.Bool("f", false, "Force running the command even after giving up")
+		graceFlag      = flag.Duration("grace-period", 10*time.Second, "Set duration resources may be unavailable before applying -on-unavailable")
+		superviseFlag  = flag.Bool("supervise", false, "Run the command as child process, forwarding signals and reaping zombies, instead of replacing await")
+		infileFlag     = flag.String("i", "", "Read resources from file, '-' to read from stdin")
+		junitFlag      = flag.String("junit", "", "Write a JUnit XML report to file")
+		listenFlag     = flag.String("listen", "", "Serve the state of resources on the given address, e.g. ':8080', at /live, /ready, /status and /metrics")
+		onUnavailFlag  = flag.String("on-unavailable", string(ignoreUnavailable), "Set action once resources are unavailable while supervising the command: none, stop, restart")
+		minSuccFlag    = flag.Int("min-successes", defaultAwaitOptions.minSuccesses, "Set number of consecutive successful attempts required per resource")
+		outputFlag     = flag.String("o", textOutput, "Set output format of the final report: text, json")
+		quietFlag      = flag.Bool("q", false, "Set quiet mode")
+		retryDelayFlag = flag.Duration("retry-delay", defaultBackoff.initial, "Set initial delay between attempts")
+		retryMultFlag  = flag.Float64("retry-multiplier", defaultBackoff.multiplier, "Set factor by which the delay grows after each attempt")
+		retryMaxFlag   = flag.Duration("retry-max-delay", 0, "Set maximum delay between attempts, 0 for no limit")
+		retryJitFlag   = flag.Float64("retry-jitter", 0, "Set fraction by which each delay is randomly varied, e.g. 0.1 for +/-10%")
+		sequentialFlag = flag.Bool("s", false, "Await resources sequentially instead of concurrently")
+		stopSignalFlag = flag.String("stop-signal", "TERM", "Set signal sent to stop the supervised command")
+		stopTimeFlag   = flag.Duration("stop-timeout", 10*time.Second, "Set duration after which a command not stopping is killed, 0 for no limit")
+		stableForFlag  = flag.Duration("stable-for", 0, "Set duration a resource must be continuously available for")
+		timeoutFlag    = flag.Duration("t", 1*time.Minute, "Set timeout duration before giving up")
+		verbose1Flag   = flag.Bool("v", false, "Set verbose output mode")
+		watchFlag      = flag.Duration("watch", 0, "Keep probing resources on the given interval once available, logging whenever they change")
+		verbose2Flag   = flag.Bool("vv", false, "Set more verbose output mode")
+		versionFlag    = flag.Bool("V", false, "Show version")
 	)
 	flag.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: await [options...] <res>... [ -- <cmd>]")
+		fmt.Fprintln(os.Stderr, "       await check [options...] <res>...")
 		fmt.Fprintln(os.Stderr, "Await availability of resources.")
 		fmt.Fprintln(os.Stderr)
 		flag.PrintDefaults()
@@ -69,46 +106,229 @@ func main() {
 	}
 	logger := NewLogger(logLevel)
 
+	var cfg *config
+	if *configFlag != "" {
+		var err error
+		if cfg, err = readConfig(*configFlag); err != nil {
+			exitf(logger, exitConfig, "Error: failed to read configuration file: %v", err)
+		}
+		// Options given as flags take precedence over the configuration file
+		explicit := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		for name, val := range cfg.flagValues() {
+			if explicit[name] {
+				continue
+			}
+			if err := flag.Set(name, val); err != nil {
+				exitf(logger, exitConfig, "Error: invalid value for '%s' in configuration file: %v", name, err)
+			}
+		}
+	}
+
+	if *outputFlag != textOutput && *outputFlag != jsonOutput {
+		exitf(logger, exitConfig, "Error: unsupported output format: %s", *outputFlag)
+	}
+
 	resArgs, cmdArgs := splitArgs(flag.Args())
 	if *infileFlag != "" {
 		resFile, err := readFromFile(*infileFlag)
 		if err != nil {
-			logger.Fatalf("Error: failed to read resources file: %v", err)
+			exitf(logger, exitConfig, "Error: failed to read resources file: %v", err)
 		}
 		resArgs = append(resArgs, resFile...)
 	}
-	ress, err := parseResources(resArgs)
+	if *retryDelayFlag < 0 || *retryMultFlag < 0 || *retryMaxFlag < 0 || *retryJitFlag < 0 || *attemptFlag < 0 {
+		exitf(logger, exitConfig, "Error: retry and timeout options must not be negative")
+	}
+	if *minSuccFlag < 1 || *stableForFlag < 0 {
+		exitf(logger, exitConfig, "Error: stability options must be positive")
+	}
+	if *watchFlag < 0 {
+		exitf(logger, exitConfig, "Error: watch interval must not be negative")
+	}
+	if *watchFlag > 0 && len(cmdArgs) > 0 && !*superviseFlag {
+		exitf(logger, exitConfig, "Error: watch mode requires -supervise to be combined with a command")
+	}
+	if *listenFlag != "" && len(cmdArgs) > 0 && !*superviseFlag {
+		exitf(logger, exitConfig, "Error: serving requires -supervise to be combined with a command")
+	}
+	policy := unavailabilityPolicy(*onUnavailFlag)
+	switch policy {
+	case ignoreUnavailable:
+	case stopOnUnavailable, restartOnUnavailable:
+		if !*superviseFlag || *watchFlag <= 0 {
+			exitf(logger, exitConfig, "Error: -on-unavailable requires -supervise and -watch")
+		}
+	default:
+		exitf(logger, exitConfig, "Error: unsupported action on unavailable resources: %s", policy)
+	}
+	stopSignal, err := parseSignal(*stopSignalFlag)
 	if err != nil {
-		logger.Fatalf("Error: failed to parse resources: %v", err)
+		exitf(logger, exitConfig, "Error: invalid stop signal: %v", err)
+	}
+	if *graceFlag < 0 || *stopTimeFlag < 0 {
+		exitf(logger, exitConfig, "Error: grace period and stop timeout must not be negative")
+	}
+	defaults := awaitOptions{
+		backoff: backoff{
+			initial:    *retryDelayFlag,
+			multiplier: *retryMultFlag,
+			max:        *retryMaxFlag,
+			jitter:     *retryJitFlag,
+		},
+		attemptTimeout: *attemptFlag,
+		minSuccesses:   *minSuccFlag,
+		stableFor:      *stableForFlag,
+		failFast:       *failFastFlag,
+	}
+	targets, err := parseTargets(resArgs, defaults)
+	if err != nil {
+		exitf(logger, exitConfig, "Error: failed to parse resources: %v", err)
+	}
+	if cfg != nil {
+		cfgTargets, err := cfg.targets(defaults)
+		if err != nil {
+			exitf(logger, exitConfig, "Error: failed to parse resources of configuration file: %v", err)
+		}
+		targets = append(targets, cfgTargets...)
+	}
+	if err := linkDependencies(targets); err != nil {
+		exitf(logger, exitConfig, "Error: failed to parse resources: %v", err)
 	}
 
 	awaiter := &awaiter{
-		logger:  logger,
-		timeout: *timeoutFlag,
+		logger:     logger,
+		timeout:    *timeoutFlag,
+		sequential: *sequentialFlag,
+	}
+	var server *readinessServer
+	if *listenFlag != "" {
+		awaiter.metrics = newMetrics()
+		// Resources are reported as unavailable until they are awaited.
+		awaiter.track(targets)
+		server = newReadinessServer(logger, awaiter.metrics, awaiter.statuses)
+		if err := server.listen(*listenFlag); err != nil {
+			exitf(logger, exitConfig, "Error: failed to listen: %v", err)
+		}
+	}
+
+	started := time.Now()
+	statuses, err := awaiter.run(targets)
+
+	exitCode := exitCodeOf(err)
+	var reportErr error
+	switch {
+	case *outputFlag == jsonOutput:
+		reportErr = printJSONReport(os.Stdout, statuses, exitCode, time.Since(started))
+	case logLevel < silentLevel && len(statuses) > 0:
+		reportErr = printReport(os.Stderr, statuses)
+	}
+	if reportErr != nil {
+		logger.Errorf("Error: failed to print report: %v", reportErr)
+	}
+	if *junitFlag != "" {
+		if err := writeJUnitReport(*junitFlag, statuses, time.Since(started)); err != nil {
+			logger.Errorf("Error: failed to write JUnit report: %v", err)
+		}
 	}
 
-	if err := awaiter.run(ress); err != nil {
-		if e, ok := err.(*unavailabilityError); ok {
+	if err != nil {
+		switch e := err.(type) {
+		case *unavailabilityError:
 			logger.Errorf("Resource unavailable: %v", e)
 			logger.Errorln("Timeout exceeded")
-		} else {
-			logger.Fatalf("Error: %v", err)
+		case *permanentError:
+			logger.Errorf("Resource failed permanently (%s error): %v", e.Class, e)
+		default:
+			logger.Errorf("Error: %v", err)
 		}
 		if !*forceFlag {
-			os.Exit(1)
+			os.Exit(exitCode)
 		}
 	} else {
 		logger.Infoln("All resources available")
 	}
 
+	if len(cmdArgs) == 0 && (*watchFlag > 0 || server != nil) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if *watchFlag > 0 {
+			logger.Infof("Watching resources every %v", *watchFlag)
+			m := newMonitor(logger, *watchFlag, targets, statuses)
+			m.metrics = awaiter.metrics
+			if server != nil {
+				server.setSource(m.statuses)
+			}
+			m.run(ctx)
+		} else {
+			// Keep serving the final state of the resources
+			<-ctx.Done()
+		}
+		return
+	}
+
 	if len(cmdArgs) > 0 {
 		logger.Infof("Running command: %v", cmdArgs)
+		if *superviseFlag {
+			s := &supervisor{
+				logger:      logger,
+				policy:      policy,
+				grace:       *graceFlag,
+				stopSignal:  stopSignal,
+				stopTimeout: *stopTimeFlag,
+				reawait: func() ([]resourceStatus, error) {
+					return awaiter.run(targets)
+				},
+				reapOrphans: os.Getpid() == 1,
+			}
+			if *watchFlag > 0 {
+				s.monitor = newMonitor(logger, *watchFlag, targets, statuses)
+				s.monitor.metrics = awaiter.metrics
+				if server != nil {
+					server.setSource(s.monitor.statuses)
+				}
+			}
+			code, err := s.run(cmdArgs)
+			if err != nil {
+				exitf(logger, execErrorCode(err), "Error: failed to execute command: %v", err)
+			}
+			os.Exit(code)
+		}
 		if err := execCmd(cmdArgs); err != nil {
-			logger.Fatalf("Error: failed to execute command: %v", err)
+			exitf(logger, execErrorCode(err), "Error: failed to execute command: %v", err)
 		}
 	}
 }
 
+// execErrorCode maps a failure to execute the command to an exit code.
+func execErrorCode(err error) int {
+	if errors.Is(err, exec.ErrNotFound) {
+		return exitCmdNotFound
+	}
+	return exitCmdFailed
+}
+
+// exitCodeOf maps the outcome of awaiting resources to an exit code.
+func exitCodeOf(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return exitOK
+	case *permanentError:
+		if e.Class == configClass {
+			return exitConfig
+		}
+		return exitPermanent
+	default:
+		return exitUnavailable
+	}
+}
+
+// exitf logs an error message and exits the process with the given code.
+func exitf(logger *LevelLogger, code int, format string, v ...interface{}) {
+	logger.Errorf(format, v...)
+	os.Exit(code)
+}
+
 func splitArgs(args []string) ([]string, []string) {
 	if i := indexOf(args, "--"); i >= 0 {
 		return args[0:i], args[i+1:]
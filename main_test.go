@@ -21,6 +21,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"os"
 	"testing"
@@ -93,3 +94,20 @@ func TestSplitArgsNoResourceNoCommand(t *testing.T) {
 		t.Errorf("unexpected command found")
 	}
 }
+
+func TestExitCodeOf(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{nil, exitOK},
+		{&unavailabilityError{errors.New("connection refused")}, exitUnavailable},
+		{&permanentError{errors.New("access denied"), authClass}, exitPermanent},
+		{&permanentError{errors.New("invalid database name"), configClass}, exitConfig},
+	}
+	for _, test := range tests {
+		if actual := exitCodeOf(test.err); actual != test.expected {
+			t.Errorf("unexpected exit code for '%v': expected %d, got %d", test.err, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds of the histogram buckets, in seconds.
+var (
+	probeDurationBuckets   = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	timeToAvailableBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+)
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// resourceMetrics holds the metrics of a single resource.
+type resourceMetrics struct {
+	up              bool
+	attempts        uint64
+	failures        map[errorClass]uint64
+	probeDuration   *histogram
+	timeToAvailable *histogram
+}
+
+// metrics collects metrics of awaiting and monitoring resources, exposed in
+// the Prometheus text format. All methods are no-ops on a nil receiver, hence
+// collecting is optional.
+type metrics struct {
+	mu        sync.Mutex
+	resources map[string]*resourceMetrics
+	// labels retains the order in which resources appeared, for a stable
+	// output.
+	labels []string
+}
+
+func newMetrics() *metrics {
+	return &metrics{resources: map[string]*resourceMetrics{}}
+}
+
+// resource returns the metrics of the resource with the given label, the
+// caller must hold the lock.
+func (m *metrics) resource(label string) *resourceMetrics {
+	r, ok := m.resources[label]
+	if !ok {
+		r = &resourceMetrics{
+			failures:        map[errorClass]uint64{},
+			probeDuration:   newHistogram(probeDurationBuckets),
+			timeToAvailable: newHistogram(timeToAvailableBuckets),
+		}
+		m.resources[label] = r
+		m.labels = append(m.labels, label)
+	}
+	return r
+}
+
+// observeAttempt records a single attempt of awaiting a resource.
+func (m *metrics) observeAttempt(t *target, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.resource(redact(t.label()))
+	r.attempts++
+	if err != nil {
+		r.failures[classify(err)]++
+	}
+	r.probeDuration.observe(duration.Seconds())
+}
+
+// observeAvailable records a resource becoming available, after having been
+// awaited for the given duration.
+func (m *metrics) observeAvailable(t *target, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.resource(redact(t.label()))
+	r.up = true
+	r.timeToAvailable.observe(duration.Seconds())
+}
+
+// setUnavailable records a resource becoming unavailable.
+func (m *metrics) setUnavailable(t *target) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resource(redact(t.label())).up = false
+}
+
+// write writes all metrics in the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP await_resource_up Whether the resource is available (1) or not (0).\n")
+	b.WriteString("# TYPE await_resource_up gauge\n")
+	for _, label := range m.labels {
+		up := 0
+		if m.resources[label].up {
+			up = 1
+		}
+		fmt.Fprintf(&b, "await_resource_up{resource=%s} %d\n", quoteLabel(label), up)
+	}
+
+	b.WriteString("# HELP await_probe_attempts_total Number of attempts to await the resource.\n")
+	b.WriteString("# TYPE await_probe_attempts_total counter\n")
+	for _, label := range m.labels {
+		fmt.Fprintf(&b, "await_probe_attempts_total{resource=%s} %d\n", quoteLabel(label), m.resources[label].attempts)
+	}
+
+	b.WriteString("# HELP await_probe_failures_total Number of failed attempts to await the resource, by error class.\n")
+	b.WriteString("# TYPE await_probe_failures_total counter\n")
+	for _, label := range m.labels {
+		for _, class := range []errorClass{transientClass, configClass, authClass, tlsClass, notFoundClass} {
+			if n, ok := m.resources[label].failures[class]; ok {
+				fmt.Fprintf(&b, "await_probe_failures_total{resource=%s,class=\"%s\"} %d\n", quoteLabel(label), class, n)
+			}
+		}
+	}
+
+	writeHistograms(&b, "await_probe_duration_seconds", "Duration of attempts to await the resource.",
+		m.labels, func(label string) *histogram { return m.resources[label].probeDuration })
+	writeHistograms(&b, "await_time_to_available_seconds", "Duration of awaiting the resource until it became available.",
+		m.labels, func(label string) *histogram { return m.resources[label].timeToAvailable })
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHistograms(b *strings.Builder, name, help string, labels []string, histogramOf func(string) *histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+	for _, label := range labels {
+		h := histogramOf(label)
+		for i, bound := range h.buckets {
+			fmt.Fprintf(b, "%s_bucket{resource=%s,le=\"%g\"} %d\n", name, quoteLabel(label), bound, h.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{resource=%s,le=\"+Inf\"} %d\n", name, quoteLabel(label), h.count)
+		fmt.Fprintf(b, "%s_sum{resource=%s} %g\n", name, quoteLabel(label), h.sum)
+		fmt.Fprintf(b, "%s_count{resource=%s} %d\n", name, quoteLabel(label), h.count)
+	}
+}
+
+// quoteLabel quotes a label value as required by the Prometheus text format.
+func quoteLabel(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
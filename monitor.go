@@ -0,0 +1,153 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// monitor keeps probing resources on an interval once awaited, tracking
+// whenever they become unavailable or available again.
+type monitor struct {
+	logger   *LevelLogger
+	interval time.Duration
+	// onTransition, if set, is called whenever a resource became unavailable
+	// or available again. Calls may happen concurrently.
+	onTransition func(status resourceStatus)
+	// metrics, if set, collects metrics of all probes.
+	metrics *metrics
+
+	targets []*target
+	states  []*resourceState
+}
+
+// newMonitor creates a monitor for the given resources, starting from the
+// statuses they were left in by awaiting them.
+func newMonitor(logger *LevelLogger, interval time.Duration, targets []*target, statuses []resourceStatus) *monitor {
+	m := &monitor{
+		logger:   logger,
+		interval: interval,
+		targets:  targets,
+		states:   make([]*resourceState, len(targets)),
+	}
+	for i, t := range targets {
+		m.states[i] = &resourceState{name: t.name, resource: t.resource}
+	}
+	m.reset(statuses)
+	return m
+}
+
+// reset continues tracking the resources from the given statuses, e.g. after
+// awaiting them again. Their durations are carried over.
+func (m *monitor) reset(statuses []resourceStatus) {
+	now := time.Now()
+	for i, state := range m.states {
+		state.mu.Lock()
+		state.started, state.finished = now, now
+		state.pendingErr = nil
+		if i < len(statuses) {
+			state.available = statuses[i].State == available
+			state.attempts = statuses[i].Attempts
+			state.latestErr = statuses[i].LatestErr
+			state.started = now.Add(-statuses[i].Duration)
+		}
+		state.mu.Unlock()
+	}
+}
+
+// run probes all resources concurrently until the context is done.
+func (m *monitor) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i, t := range m.targets {
+		wg.Add(1)
+		go func(t *target, state *resourceState) {
+			defer wg.Done()
+			m.watch(ctx, t, state)
+		}(t, m.states[i])
+	}
+	wg.Wait()
+}
+
+// watch probes a single resource on every interval until the context is done.
+func (m *monitor) watch(ctx context.Context, t *target, state *resourceState) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	// Time since which the resource is unavailable, if it is
+	var downSince time.Time
+	if state.snapshot().State != available {
+		downSince = time.Now()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// A single probe must not delay the next one
+		opts := t.options
+		if opts.attemptTimeout <= 0 || opts.attemptTimeout > m.interval {
+			opts.attemptTimeout = m.interval
+		}
+		wasAvailable := state.snapshot().State == available
+		state.begin()
+		probeStarted := time.Now()
+		err := attempt(ctx, &target{resource: t.resource, options: opts})
+		if ctx.Err() != nil {
+			// Stopped while probing, the result is meaningless
+			return
+		}
+		m.metrics.observeAttempt(t, time.Since(probeStarted), err)
+		state.record(err)
+
+		status := state.snapshot()
+		switch {
+		case wasAvailable && err != nil:
+			// Transitions are the purpose of monitoring, hence logged unless
+			// in quiet mode.
+			m.logger.Errorf("Resource became unavailable: %s: %v", t, err)
+			m.metrics.setUnavailable(t)
+			downSince = time.Now()
+		case !wasAvailable && err == nil:
+			m.logger.Errorf("Resource available again: %s", t)
+			m.metrics.observeAvailable(t, time.Since(downSince))
+		default:
+			m.logger.Debugf("Resource unchanged (%s): %s", status.State, t)
+			continue
+		}
+		if m.onTransition != nil {
+			m.onTransition(status)
+		}
+	}
+}
+
+// statuses returns the current status of every monitored resource.
+func (m *monitor) statuses() []resourceStatus {
+	statuses := make([]resourceStatus, len(m.states))
+	for i, state := range m.states {
+		statuses[i] = state.snapshot()
+	}
+	return statuses
+}
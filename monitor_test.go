@@ -0,0 +1,98 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitorTransitions(t *testing.T) {
+	res := &sequenceResource{results: []error{
+		&unavailabilityError{errors.New("gone")},
+		&unavailabilityError{errors.New("still gone")},
+	}}
+	targets := targetsOf(res)
+	statuses := []resourceStatus{{Resource: res, State: available, Attempts: 1}}
+
+	var (
+		mu          sync.Mutex
+		transitions []availability
+	)
+	m := newMonitor(NewLogger(silentLevel), 10*time.Millisecond, targets, statuses)
+	m.onTransition = func(status resourceStatus) {
+		mu.Lock()
+		defer mu.Unlock()
+		transitions = append(transitions, status.State)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	m.run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(transitions) != 2 || transitions[0] != unavailable || transitions[1] != available {
+		t.Errorf("unexpected transitions: %v", transitions)
+	}
+	if status := m.statuses()[0]; status.State != available || status.Attempts < 4 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestMonitorResetDuration(t *testing.T) {
+	res := &sequenceResource{}
+	statuses := []resourceStatus{{Resource: res, State: available, Attempts: 3, Duration: 2 * time.Second}}
+
+	m := newMonitor(NewLogger(silentLevel), time.Second, targetsOf(res), statuses)
+	if d := m.statuses()[0].Duration; d != 2*time.Second {
+		t.Errorf("expected duration to be carried over, got: %v", d)
+	}
+
+	m.reset([]resourceStatus{{Resource: res, State: unavailable, Attempts: 1}})
+	if d := m.statuses()[0].Duration; d < 0 || d > time.Second {
+		t.Errorf("expected duration to restart, got: %v", d)
+	}
+
+	m.reset(nil)
+	for _, status := range m.statuses() {
+		if status.Duration < 0 {
+			t.Errorf("expected non-negative duration, got: %v", status.Duration)
+		}
+	}
+}
+
+func TestMonitorDurationFrozenWhileAvailable(t *testing.T) {
+	res := &sequenceResource{}
+	statuses := []resourceStatus{{Resource: res, State: available, Attempts: 1, Duration: 2 * time.Second}}
+
+	m := newMonitor(NewLogger(silentLevel), 5*time.Millisecond, targetsOf(res), statuses)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	m.run(ctx)
+
+	if status := m.statuses()[0]; status.Attempts < 3 || status.Duration != 2*time.Second {
+		t.Errorf("expected time to availability to remain unchanged by probes, got: %+v", status)
+	}
+}
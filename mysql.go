@@ -27,24 +27,33 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync/atomic"
 
-	_ "github.com/go-sql-driver/mysql" // Register MySQL driver
+	"github.com/go-sql-driver/mysql" // Register MySQL driver
 )
 
+// mysqlTLSConfigs counts the TLS configurations registered with the driver.
+var mysqlTLSConfigs uint64
+
 type mysqlResource struct {
 	url.URL
 }
 
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (r *mysqlResource) String() string {
+	return redactURL(r.URL)
+}
+
 func (r *mysqlResource) Await(ctx context.Context) error {
-	opts := parseFragment(r.URL.Fragment)
+	opts := parseFragment(r.URL.EscapedFragment())
 
 	database := strings.TrimPrefix(r.URL.Path, "/")
 	if strings.Contains(database, "/") {
-		return fmt.Errorf("invalid database name: %s", database)
+		return &resourceConfigError{fmt.Errorf("invalid database name: %s", database)}
 	}
 	if database == "" {
 		if _, ok := opts["tables"]; ok {
-			return fmt.Errorf("database name required for awaiting tables")
+			return &resourceConfigError{errors.New("database name required for awaiting tables")}
 		}
 		// Special database default which usually exists.
 		database = "information_schema"
@@ -53,10 +62,29 @@ func (r *mysqlResource) Await(ctx context.Context) error {
 	dsnURL := r.URL
 	dsnURL.Fragment = ""
 	dsnURL.Path = database
+	tlsConfig, err := tlsConfigOf(r.URL)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		// The driver refers to custom TLS configurations by a registered name,
+		// unique per attempt as abandoned ones may still deregister theirs.
+		name := fmt.Sprintf("await-%d", atomic.AddUint64(&mysqlTLSConfigs, 1))
+		if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+			return err
+		}
+		defer mysql.DeregisterTLSConfig(name)
+		query := dsnURL.Query()
+		query.Set("tls", name)
+		dsnURL.RawQuery = query.Encode()
+	}
 	dsnURL.Host = "tcp(" + dsnURL.Host + ")"
 	dsn := dsnURL.String()
 	// Comply to Go's MySQL driver DSN convention
 	dsn = strings.TrimPrefix(dsn, "mysql://")
+	if _, err := mysql.ParseDSN(dsn); err != nil {
+		return &resourceConfigError{err}
+	}
 
 	db, err := sql.Open(dsnURL.Scheme, dsn)
 	if err != nil {
@@ -64,7 +92,7 @@ func (r *mysqlResource) Await(ctx context.Context) error {
 	}
 	defer func() { _ = db.Close() }()
 
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		return &unavailabilityError{err}
 	}
 
@@ -73,7 +101,7 @@ func (r *mysqlResource) Await(ctx context.Context) error {
 		if len(val) > 0 && val[0] != "" {
 			tables = strings.Split(val[0], ",")
 		}
-		if err := awaitMySQLTables(db, database, tables); err != nil {
+		if err := awaitMySQLTables(ctx, db, database, tables); err != nil {
 			return err
 		}
 	}
@@ -81,11 +109,11 @@ func (r *mysqlResource) Await(ctx context.Context) error {
 	return nil
 }
 
-func awaitMySQLTables(db *sql.DB, dbName string, tables []string) error {
+func awaitMySQLTables(ctx context.Context, db *sql.DB, dbName string, tables []string) error {
 	if len(tables) == 0 {
 		const stmt = `SELECT count(*) FROM information_schema.tables WHERE table_schema=?`
 		var tableCnt int
-		if err := db.QueryRow(stmt, dbName).Scan(&tableCnt); err != nil {
+		if err := db.QueryRowContext(ctx, stmt, dbName).Scan(&tableCnt); err != nil {
 			return err
 		}
 
@@ -97,7 +125,7 @@ func awaitMySQLTables(db *sql.DB, dbName string, tables []string) error {
 	}
 
 	const stmt = `SELECT table_name FROM information_schema.tables WHERE table_schema=?`
-	rows, err := db.Query(stmt, dbName)
+	rows, err := db.QueryContext(ctx, stmt, dbName)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,189 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// placeholder is a reference to a value resolved at parse time, given as
+// `${<ref>}` within a resource URL.
+type placeholder struct {
+	start, end int // Position within the template, including `${` and `}`
+	ref        string
+}
+
+// findPlaceholders returns all placeholders of a template. A literal `${` can
+// be given as `$${`.
+func findPlaceholders(template string) ([]placeholder, error) {
+	var placeholders []placeholder
+	for i := 0; i < len(template); i++ {
+		switch {
+		case strings.HasPrefix(template[i:], "$${"):
+			i += 2
+		case strings.HasPrefix(template[i:], "${"):
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated placeholder: %s", template[i:])
+			}
+			placeholders = append(placeholders, placeholder{i, i + end + 1, template[i+2 : i+end]})
+			i += end
+		}
+	}
+	return placeholders, nil
+}
+
+// expandPlaceholders resolves all placeholders of a resource URL:
+//
+//   - `${NAME}` resolves to the value of the environment variable NAME, which
+//     must be set, `${NAME:-default}` falls back to a default value instead
+//   - `${file://<path>}` resolves to the contents of the file at the given
+//     path, e.g. a Docker secret, stripped of trailing newlines
+//
+// Values placed within the userinfo, query or fragment of a URL are escaped,
+// hence passwords, DSN parameters and options may contain any characters.
+func expandPlaceholders(template string) (string, error) {
+	return expand(template, true)
+}
+
+// expandValuePlaceholders resolves all placeholders of a plain value, e.g. an
+// option given in a configuration file, without escaping.
+func expandValuePlaceholders(template string) (string, error) {
+	return expand(template, false)
+}
+
+func expand(template string, isURL bool) (string, error) {
+	placeholders, err := findPlaceholders(template)
+	if err != nil {
+		return "", err
+	}
+	userinfoStart, userinfoEnd, queryStart := -1, -1, -1
+	if isURL {
+		userinfoStart, userinfoEnd = userinfoRange(template, placeholders)
+		queryStart = queryIndex(template, placeholders)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, p := range placeholders {
+		val, err := resolvePlaceholder(p.ref)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case p.start >= userinfoStart && p.end <= userinfoEnd:
+			val = escapeUserinfo(val)
+		case queryStart >= 0 && p.start > queryStart:
+			val = url.QueryEscape(val)
+		}
+		b.WriteString(strings.ReplaceAll(template[last:p.start], "$${", "${"))
+		b.WriteString(val)
+		last = p.end
+	}
+	b.WriteString(strings.ReplaceAll(template[last:], "$${", "${"))
+	return b.String(), nil
+}
+
+func resolvePlaceholder(ref string) (string, error) {
+	if strings.HasPrefix(ref, "file://") {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		// Unify absolute and relative file paths, the same as file resources
+		content, err := os.ReadFile(filepath.Join(u.Host, u.Path))
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve placeholder: %v", err)
+		}
+		val := strings.TrimRight(string(content), "\r\n")
+		// Contents of files are secret by nature, e.g. Docker secrets
+		secrets.add(val)
+		return val, nil
+	}
+
+	name, defaultVal, hasDefault := strings.Cut(ref, ":-")
+	if val, ok := os.LookupEnv(name); ok && (val != "" || !hasDefault) {
+		return val, nil
+	}
+	if hasDefault {
+		return defaultVal, nil
+	}
+	return "", fmt.Errorf("failed to resolve placeholder: environment variable not set: %s", name)
+}
+
+// maskPlaceholders returns the template with all characters within
+// placeholders replaced, to not mistake them for delimiters of the URL.
+func maskPlaceholders(template string, placeholders []placeholder) []byte {
+	masked := []byte(template)
+	for _, p := range placeholders {
+		for i := p.start; i < p.end; i++ {
+			masked[i] = '_'
+		}
+	}
+	return masked
+}
+
+// queryIndex returns the position of the query or, lacking one, the fragment
+// within a URL template, -1 if there is neither or the template is no URL,
+// like commands.
+func queryIndex(template string, placeholders []placeholder) int {
+	masked := maskPlaceholders(template, placeholders)
+	schemeEnd := strings.Index(string(masked), "://")
+	if schemeEnd < 0 {
+		return -1
+	}
+	i := strings.IndexAny(string(masked[schemeEnd+3:]), "?#")
+	if i < 0 {
+		return -1
+	}
+	return schemeEnd + 3 + i
+}
+
+// userinfoRange returns the position of the userinfo within a URL template,
+// disregarding any characters within placeholders. Both are -1 if there is no
+// userinfo.
+func userinfoRange(template string, placeholders []placeholder) (int, int) {
+	masked := maskPlaceholders(template, placeholders)
+
+	schemeEnd := strings.Index(string(masked), "://")
+	if schemeEnd < 0 {
+		return -1, -1
+	}
+	authority := masked[schemeEnd+3:]
+	if end := strings.IndexAny(string(authority), "/?#"); end >= 0 {
+		authority = authority[:end]
+	}
+	at := strings.LastIndexByte(string(authority), '@')
+	if at < 0 {
+		return -1, -1
+	}
+	return schemeEnd + 3, schemeEnd + 3 + at
+}
+
+// escapeUserinfo escapes all but unreserved characters, to be used as user
+// name or password of a URL.
+func escapeUserinfo(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
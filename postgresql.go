@@ -22,40 +22,59 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/url"
 	"strings"
+	"time"
 
-	_ "github.com/lib/pq" // Register Postgres driver
+	"github.com/lib/pq"
 )
 
 type postgresqlResource struct {
 	url.URL
 }
 
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (r *postgresqlResource) String() string {
+	return redactURL(r.URL)
+}
+
 func (r *postgresqlResource) Await(ctx context.Context) error {
-	opts := parseFragment(r.URL.Fragment)
+	opts := parseFragment(r.URL.EscapedFragment())
 
 	database := strings.TrimPrefix(r.URL.Path, "/")
 	if strings.Contains(database, "/") {
-		return fmt.Errorf("invalid database name: %s", database)
+		return &resourceConfigError{fmt.Errorf("invalid database name: %s", database)}
 	}
 	if database == "" {
 		if _, ok := opts["tables"]; ok {
-			return fmt.Errorf("database name required for awaiting tables")
+			return &resourceConfigError{errors.New("database name required for awaiting tables")}
 		}
 		// Special database default which usually exists.
 		database = "information_schema"
 	}
 
-	// Disable TLS/SSL by default
 	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return &resourceConfigError{err}
+	}
+	tlsConfig, err := tlsConfigOf(r.URL)
 	if err != nil {
 		return err
 	}
-	if query.Get("sslmode") == "" {
+	if tlsConfig != nil {
+		if query.Get("sslmode") != "" {
+			return &resourceConfigError{errors.New("'sslmode' cannot be combined with the TLS options of the fragment")}
+		}
+		// TLS is established by the dialer instead of the driver
+		query.Set("sslmode", "disable")
+	} else if query.Get("sslmode") == "" {
+		// Disable TLS/SSL by default
 		query.Set("sslmode", "disable")
 	}
 
@@ -65,13 +84,17 @@ func (r *postgresqlResource) Await(ctx context.Context) error {
 	dsnURL.RawQuery = query.Encode()
 	dsn := dsnURL.String()
 
-	db, err := sql.Open(dsnURL.Scheme, dsn)
+	connector, err := pq.NewConnector(dsn)
 	if err != nil {
-		return err
+		return &resourceConfigError{err}
+	}
+	if tlsConfig != nil {
+		connector.Dialer(&postgresqlTLSDialer{config: tlsConfig})
 	}
+	db := sql.OpenDB(connector)
 	defer func() { _ = db.Close() }()
 
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		return &unavailabilityError{err}
 	}
 
@@ -80,7 +103,7 @@ func (r *postgresqlResource) Await(ctx context.Context) error {
 		if len(val) > 0 && val[0] != "" {
 			tables = strings.Split(val[0], ",")
 		}
-		if err := awaitPostgreSQLTables(db, database, tables); err != nil {
+		if err := awaitPostgreSQLTables(ctx, db, database, tables); err != nil {
 			return err
 		}
 	}
@@ -88,11 +111,76 @@ func (r *postgresqlResource) Await(ctx context.Context) error {
 	return nil
 }
 
-func awaitPostgreSQLTables(db *sql.DB, dbName string, tables []string) error {
+// postgresqlTLSDialer establishes TLS connections to PostgreSQL servers
+// itself, as lib/pq lacks some of the shared TLS options. The driver continues
+// on the encrypted connection as if it was a plain one.
+type postgresqlTLSDialer struct {
+	config *tls.Config
+}
+
+// sslRequest asks the server to switch to TLS: message length and code.
+var sslRequest = []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}
+
+func (d *postgresqlTLSDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *postgresqlTLSDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+func (d *postgresqlTLSDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn, err := d.handshake(ctx, conn, address)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (d *postgresqlTLSDialer) handshake(ctx context.Context, conn net.Conn, address string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := conn.Write(sslRequest); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if resp[0] != 'S' {
+		return nil, pq.ErrSSLNotSupported
+	}
+
+	cfg := d.config.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	// The driver sets its own deadlines, if any
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func awaitPostgreSQLTables(ctx context.Context, db *sql.DB, dbName string, tables []string) error {
 	if len(tables) == 0 {
 		const stmt = `SELECT count(*) FROM information_schema.tables WHERE table_catalog=$1 AND table_schema='public'`
 		var tableCnt int
-		if err := db.QueryRow(stmt, dbName).Scan(&tableCnt); err != nil {
+		if err := db.QueryRowContext(ctx, stmt, dbName).Scan(&tableCnt); err != nil {
 			return err
 		}
 
@@ -104,7 +192,7 @@ func awaitPostgreSQLTables(db *sql.DB, dbName string, tables []string) error {
 	}
 
 	const stmt = `SELECT table_name FROM information_schema.tables WHERE table_catalog=$1 AND table_schema='public'`
-	rows, err := db.Query(stmt, dbName)
+	rows, err := db.QueryContext(ctx, stmt, dbName)
 	if err != nil {
 		return err
 	}
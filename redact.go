@@ -0,0 +1,231 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secrets in any output, the same as url.URL.Redacted does.
+const redacted = "xxxxx"
+
+// minSecretLength is the minimum length of secrets scrubbed from arbitrary
+// output. Shorter ones, like a password of "1", would mangle unrelated text,
+// hence they are only redacted from URLs by redactURL.
+const minSecretLength = 8
+
+// sensitiveKeys lists (lowercase) query and fragment keys whose values are
+// considered secret.
+var sensitiveKeys = map[string]bool{
+	"access_token":  true,
+	"api_key":       true,
+	"api-key":       true,
+	"apikey":        true,
+	"client_secret": true,
+	"pass":          true,
+	"passwd":        true,
+	"password":      true,
+	"pwd":           true,
+	"secret":        true,
+	"sslpassword":   true,
+	"token":         true,
+}
+
+// sensitiveHeaders lists (canonical) HTTP headers whose values are considered
+// secret.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+	"X-Auth-Token":        true,
+}
+
+// secretSet collects all secrets encountered while parsing resources, so they
+// can be scrubbed from any output, including error messages of third party
+// libraries.
+type secretSet struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+var secrets = &secretSet{}
+
+func (s *secretSet) add(secret string) {
+	if len(secret) < minSecretLength || secret == redacted {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, known := range s.secrets {
+		if known == secret {
+			return
+		}
+	}
+	s.secrets = append(s.secrets, secret)
+	// Replace longer secrets first, in case one contains another
+	sort.Slice(s.secrets, func(i, j int) bool { return len(s.secrets[i]) > len(s.secrets[j]) })
+}
+
+// redact replaces all known secrets in the given string.
+func (s *secretSet) redact(str string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, secret := range s.secrets {
+		str = replaceSecret(str, secret)
+	}
+	return str
+}
+
+// replaceSecret replaces a secret in the given string, including its escaped
+// forms as they show up in URLs.
+func replaceSecret(str, secret string) string {
+	str = strings.ReplaceAll(str, secret, redacted)
+	if escaped := url.QueryEscape(secret); escaped != secret {
+		str = strings.ReplaceAll(str, escaped, redacted)
+	}
+	if escaped := url.PathEscape(secret); escaped != secret {
+		str = strings.ReplaceAll(str, escaped, redacted)
+	}
+	return str
+}
+
+// redact replaces all known secrets in the given string.
+func redact(str string) string {
+	return secrets.redact(str)
+}
+
+// registerSecrets remembers the secrets contained in a resource URL. Secrets
+// equal to a non-secret part of the URL, like "postgres" being used as user
+// and password, are not remembered, as scrubbing them would mangle the URL
+// itself; redactURL still replaces them within URLs.
+func registerSecrets(u url.URL) {
+	public := map[string]bool{u.Scheme: true, u.Hostname(): true}
+	if u.User != nil {
+		public[u.User.Username()] = true
+	}
+	for _, secret := range urlSecrets(u) {
+		if !public[secret] {
+			secrets.add(secret)
+		}
+	}
+}
+
+// redactURL returns the string representation of a URL with its secrets
+// replaced: the password, values of sensitive query and fragment keys and
+// values of sensitive headers.
+func redactURL(u url.URL) string {
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+	}
+	if query, ok := redactValues(parseQuery(u.RawQuery)); ok {
+		u.RawQuery = query.Encode()
+	}
+	// Re-encoding the fragment would not retain its original form, so replace
+	// secrets in its string representation.
+	fragment := u.EscapedFragment()
+	for _, secret := range valueSecrets(parseFragment(fragment)) {
+		fragment = replaceSecret(fragment, secret)
+	}
+	u.Fragment, u.RawFragment = "", ""
+
+	if fragment != "" {
+		return u.String() + "#" + fragment
+	}
+	return u.String()
+}
+
+// redactValues replaces the values of sensitive keys. It reports whether
+// anything was replaced.
+func redactValues(values url.Values) (url.Values, bool) {
+	replaced := false
+	for key, vals := range values {
+		for i, val := range vals {
+			if secret, ok := sensitiveValue(key, val); ok {
+				vals[i] = strings.Replace(val, secret, redacted, 1)
+				replaced = true
+			}
+		}
+	}
+	return values, replaced
+}
+
+// urlSecrets returns the secrets contained in a URL.
+func urlSecrets(u url.URL) []string {
+	var secrets []string
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok && password != "" {
+			secrets = append(secrets, password)
+		}
+	}
+	secrets = append(secrets, valueSecrets(parseQuery(u.RawQuery))...)
+	secrets = append(secrets, valueSecrets(parseFragment(u.EscapedFragment()))...)
+	return secrets
+}
+
+// valueSecrets returns the secrets contained in query or fragment values.
+func valueSecrets(values url.Values) []string {
+	var secrets []string
+	for key, vals := range values {
+		for _, val := range vals {
+			if secret, ok := sensitiveValue(key, val); ok {
+				secrets = append(secrets, secret)
+			}
+		}
+	}
+	return secrets
+}
+
+// sensitiveValue returns the secret part of a query or fragment value, if
+// any. Headers are given as `header=<name>:<value>`, where only the value is
+// secret, proxies as URL, where only the password is.
+func sensitiveValue(key, val string) (string, bool) {
+	key = strings.ToLower(key)
+	if key == "proxy" {
+		u, err := url.Parse(val)
+		if err != nil || u.User == nil {
+			return "", false
+		}
+		password, ok := u.User.Password()
+		return password, ok && password != ""
+	}
+	if key == "header" {
+		name, value, ok := strings.Cut(val, ":")
+		if !ok || !sensitiveHeaders[http.CanonicalHeaderKey(strings.TrimSpace(name))] {
+			return "", false
+		}
+		value = strings.TrimSpace(value)
+		return value, value != ""
+	}
+	return val, sensitiveKeys[key] && val != ""
+}
+
+func parseQuery(query string) url.Values {
+	// Skip encountered decoding errors, the same as for fragments
+	v, _ := url.ParseQuery(query)
+	return v
+}
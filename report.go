@@ -0,0 +1,197 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Supported output formats of the final report.
+const (
+	textOutput = "text"
+	jsonOutput = "json"
+)
+
+// printReport writes a human-readable summary of the given resource statuses.
+func printReport(w io.Writer, statuses []resourceStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tSTATE\tATTEMPTS\tDURATION\tLAST ERROR")
+	for _, s := range statuses {
+		lastErr := "-"
+		if s.LatestErr != nil {
+			lastErr = s.LatestErr.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+			redact(s.label()), s.State, s.Attempts, s.Duration.Round(time.Millisecond), redact(lastErr))
+	}
+	return tw.Flush()
+}
+
+type jsonReport struct {
+	Status          string               `json:"status"`
+	ExitCode        int                  `json:"exit_code"`
+	DurationSeconds float64              `json:"duration_seconds"`
+	Resources       []jsonResourceReport `json:"resources"`
+}
+
+type jsonResourceReport struct {
+	Name            string  `json:"name,omitempty"`
+	Resource        string  `json:"resource"`
+	Scheme          string  `json:"scheme"`
+	State           string  `json:"state"`
+	Attempts        int     `json:"attempts"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	LastError       string  `json:"last_error,omitempty"`
+}
+
+// printJSONReport writes a machine-readable summary of the given resource
+// statuses, along with the overall outcome.
+func printJSONReport(w io.Writer, statuses []resourceStatus, exitCode int, duration time.Duration) error {
+	report := jsonReport{
+		Status:          available.String(),
+		ExitCode:        exitCode,
+		DurationSeconds: duration.Seconds(),
+		Resources:       make([]jsonResourceReport, 0, len(statuses)),
+	}
+	for _, s := range statuses {
+		if s.State != available {
+			report.Status = unavailable.String()
+		}
+		r := jsonResourceReport{
+			Name:            s.Name,
+			Resource:        redact(s.Resource.String()),
+			Scheme:          schemeOf(s.Resource),
+			State:           s.State.String(),
+			Attempts:        s.Attempts,
+			DurationSeconds: s.Duration.Seconds(),
+		}
+		if s.LatestErr != nil {
+			r.LastError = redact(s.LatestErr.Error())
+		}
+		report.Resources = append(report.Resources, r)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// label returns the name identifying the resource in reports.
+func (s resourceStatus) label() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Resource.String()
+}
+
+// schemeOf returns the URL scheme of a resource, or "command" for command
+// resources which do not follow the URL syntax.
+func schemeOf(res resource) string {
+	if _, ok := res.(*groupResource); ok {
+		return "group"
+	}
+	if u, err := url.Parse(res.String()); err == nil && u.Scheme != "" {
+		return u.Scheme
+	}
+	return "command"
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      float64         `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// printJUnitReport writes the given resource statuses as a JUnit XML test
+// suite, with every resource being a test case.
+func printJUnitReport(w io.Writer, statuses []resourceStatus, duration time.Duration) error {
+	suite := junitTestSuite{
+		Name:  "await",
+		Tests: len(statuses),
+		Time:  duration.Seconds(),
+	}
+	for _, s := range statuses {
+		tc := junitTestCase{
+			Name:      redact(s.label()),
+			ClassName: "await." + schemeOf(s.Resource),
+			Time:      s.Duration.Seconds(),
+		}
+		if s.State != available {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Type:     s.State.String(),
+				Contents: fmt.Sprintf("%s after %d attempts", s.State, s.Attempts),
+			}
+			if s.LatestErr != nil {
+				tc.Failure.Message = redact(s.LatestErr.Error())
+			}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeJUnitReport writes a JUnit XML report to the given file path.
+func writeJUnitReport(path string, statuses []resourceStatus, duration time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := printJUnitReport(f, statuses, duration); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
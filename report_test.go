@@ -0,0 +1,98 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPrintJSONReport(t *testing.T) {
+	ress, err := parseResources([]string{"http://localhost:8080", "true"})
+	if err != nil {
+		t.Fatalf("failed to parse resources: %v", err)
+	}
+	statuses := []resourceStatus{
+		{Resource: ress[0], State: unavailable, Attempts: 3, Duration: 2 * time.Second, LatestErr: errors.New("503 Service Unavailable")},
+		{Resource: ress[1], State: available, Attempts: 1, Duration: time.Second},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := printJSONReport(buf, statuses, 1, 2*time.Second); err != nil {
+		t.Fatalf("failed to print report: %v", err)
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if report.Status != "unavailable" || report.ExitCode != 1 || len(report.Resources) != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	expected := jsonResourceReport{
+		Resource:        "http://localhost:8080",
+		Scheme:          "http",
+		State:           "unavailable",
+		Attempts:        3,
+		DurationSeconds: 2,
+		LastError:       "503 Service Unavailable",
+	}
+	if report.Resources[0] != expected {
+		t.Errorf("unexpected resource report: %+v", report.Resources[0])
+	}
+	if report.Resources[1].Scheme != "command" || report.Resources[1].LastError != "" {
+		t.Errorf("unexpected command resource report: %+v", report.Resources[1])
+	}
+}
+
+func TestPrintJUnitReport(t *testing.T) {
+	ress, err := parseResources([]string{"http://localhost:8080", "true"})
+	if err != nil {
+		t.Fatalf("failed to parse resources: %v", err)
+	}
+	statuses := []resourceStatus{
+		{Resource: ress[0], State: unavailable, Attempts: 3, Duration: 2 * time.Second, LatestErr: errors.New("503 Service Unavailable")},
+		{Resource: ress[1], State: available, Attempts: 1, Duration: time.Second},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := printJUnitReport(buf, statuses, 2*time.Second); err != nil {
+		t.Fatalf("failed to print report: %v", err)
+	}
+
+	var suite junitTestSuite
+	if err := xml.Unmarshal(buf.Bytes(), &suite); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if suite.Tests != 2 || suite.Failures != 1 || len(suite.TestCases) != 2 {
+		t.Fatalf("unexpected test suite: %+v", suite)
+	}
+	if tc := suite.TestCases[0]; tc.Failure == nil || tc.Failure.Message != "503 Service Unavailable" || tc.Time != 2 {
+		t.Errorf("unexpected failed test case: %+v", tc)
+	}
+	if tc := suite.TestCases[1]; tc.Failure != nil || tc.Name != "true" {
+		t.Errorf("unexpected successful test case: %+v", tc)
+	}
+}
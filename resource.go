@@ -23,6 +23,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"strings"
 )
 
 type resource interface {
@@ -43,11 +44,21 @@ func (e *unavailabilityError) Error() string {
 	return e.Reason.Error()
 }
 
+// Unwrap returns the underlying error.
+func (e *unavailabilityError) Unwrap() error {
+	return e.Reason
+}
+
 // Error implements the error interface.
 func (e *resourceConfigError) Error() string {
 	return e.Reason.Error()
 }
 
+// Unwrap returns the underlying error.
+func (e *resourceConfigError) Unwrap() error {
+	return e.Reason
+}
+
 func parseResource(urlAsString string) (resource, error) {
 	resources, err := parseResources([]string{urlAsString})
 	if err != nil {
@@ -57,27 +68,96 @@ func parseResource(urlAsString string) (resource, error) {
 }
 
 func parseResources(urlArgs []string) ([]resource, error) {
-	var resources []resource
+	targets, err := parseTargets(urlArgs, defaultAwaitOptions)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]resource, len(targets))
+	for i, t := range targets {
+		resources[i] = t.resource
+	}
+	return resources, nil
+}
+
+func parseTargets(urlArgs []string, defaults awaitOptions) ([]*target, error) {
+	var targets []*target
 	for _, urlArg := range urlArgs {
-		// Leveraging the fact the Go's URL parser matches e.g. `curl -s
-		// http://example.com` as url.Path instead of throwing an error.
-		u, err := url.Parse(urlArg)
+		if isGroup(urlArg) {
+			g, err := parseGroup(urlArg)
+			if err != nil {
+				return nil, &resourceConfigError{fmt.Errorf("%s: %v", redact(urlArg), err)}
+			}
+			targets = append(targets, &target{resource: g, options: defaults})
+			continue
+		}
+		u, err := parseURL(urlArg)
 		if err != nil {
 			return nil, err
 		}
-		res, err := identifyResource(*u)
+		t, err := newTarget(*u, defaults)
 		if err != nil {
 			return nil, err
 		}
-		resources = append(resources, res)
+		targets = append(targets, t)
 	}
-	return resources, nil
+	return targets, nil
+}
+
+// parseURL resolves the placeholders of a resource URL and parses it.
+func parseURL(urlArg string) (*url.URL, error) {
+	expanded, err := expandPlaceholders(urlArg)
+	if err != nil {
+		return nil, err
+	}
+	// Leveraging the fact the Go's URL parser matches e.g. `curl -s
+	// http://example.com` as url.Path instead of throwing an error.
+	return url.Parse(expanded)
+}
+
+func newTarget(u url.URL, defaults awaitOptions) (*target, error) {
+	registerSecrets(u)
+	res, err := identifyResource(u)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseAwaitOptions(u, defaults)
+	if err != nil {
+		return nil, err
+	}
+	t := &target{resource: res, options: opts, name: getOptOrDefault(u, "name", "")}
+	if after := getOptOrDefault(u, "after", ""); after != "" {
+		t.after = strings.Split(after, ",")
+	}
+	return t, nil
+}
+
+// tlsSchemes lists the schemes of resources supporting the shared TLS options.
+// Others, like plain `http`, reject them rather than silently connecting
+// without TLS.
+var tlsSchemes = map[string]bool{
+	"https":    true,
+	"wss":      true,
+	"postgres": true,
+	"mysql":    true,
+	"kafkas":   true,
+	"amqps":    true,
 }
 
 func identifyResource(u url.URL) (resource, error) {
+	// Commands lack a scheme, their fragment is no business of await
+	if u.Scheme != "" {
+		tlsOpts, err := parseTLSOptions(u)
+		if err != nil {
+			return nil, err
+		}
+		if tlsOpts.isSet() && !tlsSchemes[u.Scheme] {
+			return nil, &resourceConfigError{fmt.Errorf("%v: TLS options not supported by '%s' resources", redactURL(u), u.Scheme)}
+		}
+	}
+
 	switch u.Scheme {
 	case "http", "https":
-		return &httpResource{u}, nil
+		return newHTTPResource(u)
 	case "ws", "wss":
 		return &websocketResource{u}, nil
 	case "tcp", "tcp4", "tcp6":
@@ -99,6 +179,9 @@ func identifyResource(u url.URL) (resource, error) {
 	}
 }
 
+// parseFragment parses the options of an escaped fragment, as returned by
+// url.URL.EscapedFragment. Parsing url.URL.Fragment instead would decode
+// values twice, e.g. turning `%2B` into a space.
 func parseFragment(fragment string) url.Values {
 	// Skip encountered decoding errors on invalid format for now
 	v, _ := url.ParseQuery(fragment)
@@ -108,8 +191,15 @@ func parseFragment(fragment string) url.Values {
 	return v
 }
 
+// setFragment replaces the fragment of a URL by the given options.
+func setFragment(u *url.URL, opts url.Values) {
+	u.RawFragment = opts.Encode()
+	// Encoded options are a valid fragment, hence unescaping cannot fail
+	u.Fragment, _ = url.PathUnescape(u.RawFragment)
+}
+
 func getOptOrDefault(url url.URL, key string, defaultVal string) string {
-	opts := parseFragment(url.Fragment)
+	opts := parseFragment(url.EscapedFragment())
 	if val, ok := opts[key]; ok {
 		if len(val) > 0 && val[0] != "" {
 			return val[0]
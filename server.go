@@ -0,0 +1,117 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readinessServer exposes the state of all resources via HTTP, e.g. to be
+// queried by Kubernetes probes or healthchecks of Docker Compose:
+//
+//   - /live responds with 200 as long as await is running
+//   - /ready responds with 200 if all resources are available, 503 otherwise
+//   - /status responds with the per-resource details as JSON
+//   - /metrics responds with metrics in the Prometheus text format
+type readinessServer struct {
+	logger  *LevelLogger
+	started time.Time
+	metrics *metrics
+
+	mu sync.Mutex
+	// source returns the current status of every resource. It changes from
+	// the awaiter to the monitor once all resources were awaited.
+	source func() []resourceStatus
+}
+
+func newReadinessServer(logger *LevelLogger, metrics *metrics, source func() []resourceStatus) *readinessServer {
+	return &readinessServer{logger: logger, started: time.Now(), metrics: metrics, source: source}
+}
+
+// setSource changes where the current status of every resource is taken
+// from.
+func (s *readinessServer) setSource(source func() []resourceStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source = source
+}
+
+func (s *readinessServer) statuses() []resourceStatus {
+	s.mu.Lock()
+	source := s.source
+	s.mu.Unlock()
+	return source()
+}
+
+// listen starts serving on the given address in the background. It only
+// returns an error if the address cannot be listened on.
+func (s *readinessServer) listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("Listening on %s", l.Addr())
+	go func() {
+		if err := http.Serve(l, s.handler()); err != nil {
+			s.logger.Errorf("Error: failed to serve: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *readinessServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if down := unavailableResources(s.statuses()); len(down) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			for _, label := range down {
+				fmt.Fprintf(w, "unavailable: %s\n", redact(label))
+			}
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		statuses := s.statuses()
+		exitCode := exitOK
+		if len(unavailableResources(statuses)) > 0 {
+			exitCode = exitUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := printJSONReport(w, statuses, exitCode, time.Since(s.started)); err != nil {
+			s.logger.Errorf("Error: failed to write status: %v", err)
+		}
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := s.metrics.write(w); err != nil {
+			s.logger.Errorf("Error: failed to write metrics: %v", err)
+		}
+	})
+	return mux
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadinessServer(t *testing.T) {
+	statuses := []resourceStatus{
+		{Name: "db", Resource: &fakeResource{name: "postgres://localhost"}, State: available, Attempts: 1},
+		{Resource: &fakeResource{name: "http://localhost"}, State: unavailable, Attempts: 3, LatestErr: errors.New("refused")},
+	}
+	server := newReadinessServer(NewLogger(silentLevel), newMetrics(), func() []resourceStatus { return statuses })
+	handler := server.handler()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/live"); rec.Code != http.StatusOK {
+		t.Errorf("unexpected status of /live: %d", rec.Code)
+	}
+	if rec := get("/ready"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status of /ready: %d", rec.Code)
+	}
+
+	rec := get("/status")
+	var report jsonReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if report.Status != "unavailable" || len(report.Resources) != 2 || report.Resources[1].LastError != "refused" {
+		t.Errorf("unexpected status: %+v", report)
+	}
+
+	statuses[1].State = available
+	if rec := get("/ready"); rec.Code != http.StatusOK {
+		t.Errorf("unexpected status of /ready once available: %d", rec.Code)
+	}
+}
+
+func TestReadinessServerBeforeRun(t *testing.T) {
+	a := &awaiter{logger: NewLogger(silentLevel)}
+	a.track([]*target{{resource: &fakeResource{name: "http://localhost"}, options: defaultAwaitOptions}})
+	server := newReadinessServer(NewLogger(silentLevel), newMetrics(), a.statuses)
+
+	rec := httptest.NewRecorder()
+	server.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status of /ready before awaiting: %d", rec.Code)
+	}
+}
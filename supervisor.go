@@ -0,0 +1,369 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// forwardedSignals are passed on to the supervised command.
+var forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP}
+
+// ownedProcesses tracks the child processes waited for by their exec.Cmd,
+// e.g. those of command resources, which reaping orphans must leave alone.
+var ownedProcesses = &processSet{pids: map[int]bool{}}
+
+type processSet struct {
+	mu   sync.Mutex
+	pids map[int]bool
+}
+
+// run starts the command and waits for it to finish, keeping it from being
+// reaped by anyone else meanwhile.
+func (p *processSet) run(cmd *exec.Cmd) error {
+	// Starting while holding the lock guarantees processes are known before
+	// any reaping could encounter them.
+	p.mu.Lock()
+	if err := cmd.Start(); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	pid := cmd.Process.Pid
+	p.pids[pid] = true
+	p.mu.Unlock()
+
+	err := cmd.Wait()
+	p.mu.Lock()
+	delete(p.pids, pid)
+	p.mu.Unlock()
+	return err
+}
+
+// unavailabilityPolicy determines how the supervisor reacts to resources
+// becoming unavailable while the command runs.
+type unavailabilityPolicy string
+
+const (
+	ignoreUnavailable    unavailabilityPolicy = "none"
+	stopOnUnavailable    unavailabilityPolicy = "stop"
+	restartOnUnavailable unavailabilityPolicy = "restart"
+)
+
+// supervisor runs a command as child process instead of replacing the
+// process, forwarding signals to it and reaping zombie processes like a
+// minimal init.
+type supervisor struct {
+	logger *LevelLogger
+	// monitor, if set, keeps probing the resources while the command runs.
+	monitor *monitor
+
+	// policy determines what happens once any resource has been unavailable
+	// for longer than the grace period, requiring a monitor. The command is
+	// stopped by sending stopSignal, and killed if still running after
+	// stopTimeout, if set.
+	policy      unavailabilityPolicy
+	grace       time.Duration
+	stopSignal  syscall.Signal
+	stopTimeout time.Duration
+	// reawait awaits all resources again before restarting the command.
+	reawait func() ([]resourceStatus, error)
+	// reapOrphans is whether to reap any terminated child besides the
+	// command, required when running as PID 1, e.g. in a container, as
+	// orphaned processes get re-parented to it.
+	reapOrphans bool
+}
+
+// run starts the command and blocks until it exited. It returns the exit code
+// of the command, 128 plus the signal number if it was killed by a signal.
+func (s *supervisor) run(cmdArgs []string) (int, error) {
+	// Subscribe before starting the command to not miss its termination
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals, append(forwardedSignals, syscall.SIGCHLD)...)
+	defer signal.Stop(signals)
+
+	for {
+		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Start(); err != nil {
+			return 0, err
+		}
+		s.logger.Debugf("Command started with PID %d", cmd.Process.Pid)
+
+		// Transitions merely trigger re-evaluating the statuses of all
+		// resources, hence need not be queued.
+		changed := make(chan struct{}, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		monitorDone := make(chan struct{})
+		if s.monitor != nil {
+			s.monitor.onTransition = func(resourceStatus) {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+			go func() {
+				defer close(monitorDone)
+				s.monitor.run(ctx)
+			}()
+		} else {
+			close(monitorDone)
+		}
+
+		code, stopped := s.wait(cmd, signals, changed)
+		cancel()
+		<-monitorDone
+		if !stopped {
+			s.logger.Infof("Command exited with code %d", code)
+			return code, nil
+		}
+		if s.policy == stopOnUnavailable {
+			s.logger.Errorf("Command stopped with code %d due to unavailable resources", code)
+			return exitUnavailable, nil
+		}
+
+		s.logger.Errorf("Command stopped with code %d due to unavailable resources, awaiting them before restarting", code)
+		statuses, sig, err := s.awaitAgain(signals)
+		if sig != 0 {
+			s.logger.Errorf("Received %v while awaiting resources, giving up", sig)
+			return 128 + int(sig), nil
+		}
+		if err != nil {
+			s.logger.Errorf("Resources unavailable, not restarting command: %v", err)
+			return exitCodeOf(err), nil
+		}
+		s.monitor.reset(statuses)
+		s.logger.Errorln("Resources available again, restarting command")
+	}
+}
+
+// wait blocks until the command exited, forwarding signals to it meanwhile.
+// It reports whether the command was stopped due to unavailable resources.
+func (s *supervisor) wait(cmd *exec.Cmd, signals <-chan os.Signal, changed <-chan struct{}) (int, bool) {
+	var (
+		stopping bool
+		grace    <-chan time.Time
+		kill     <-chan time.Time
+		timer    *time.Timer
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGCHLD {
+				if code, exited := s.reap(cmd.Process.Pid); exited {
+					return code, stopping
+				}
+				continue
+			}
+			s.logger.Debugf("Forwarding signal to command: %v", sig)
+			_ = cmd.Process.Signal(sig)
+
+		case <-changed:
+			if s.policy == ignoreUnavailable || stopping {
+				continue
+			}
+			if down := unavailableResources(s.monitor.statuses()); len(down) == 0 {
+				if timer != nil {
+					s.logger.Errorln("Resources available again, keeping command running")
+					timer.Stop()
+					timer, grace = nil, nil
+				}
+			} else if timer == nil {
+				s.logger.Errorf("Resources unavailable, stopping command unless available again within %v: %s",
+					s.grace, strings.Join(down, ", "))
+				timer = time.NewTimer(s.grace)
+				grace = timer.C
+			}
+
+		case <-grace:
+			s.logger.Errorf("Resources unavailable for %v, stopping command with %v", s.grace, s.stopSignal)
+			stopping, grace = true, nil
+			_ = cmd.Process.Signal(s.stopSignal)
+			if s.stopTimeout > 0 {
+				kill = time.After(s.stopTimeout)
+			}
+
+		case <-kill:
+			s.logger.Errorf("Command did not stop within %v, killing it", s.stopTimeout)
+			kill = nil
+			_ = cmd.Process.Kill()
+		}
+	}
+}
+
+// awaitAgain awaits all resources while no command is running. Receiving any
+// of the forwarded signals meanwhile gives up, which is reported by returning
+// the signal.
+func (s *supervisor) awaitAgain(signals <-chan os.Signal) ([]resourceStatus, syscall.Signal, error) {
+	type result struct {
+		statuses []resourceStatus
+		err      error
+	}
+	results := make(chan result, 1)
+	go func() {
+		statuses, err := s.reawait()
+		results <- result{statuses, err}
+	}()
+
+	for {
+		select {
+		case r := <-results:
+			return r.statuses, 0, r.err
+		case sig := <-signals:
+			if sig == syscall.SIGCHLD {
+				s.reap(0)
+				continue
+			}
+			return nil, sig.(syscall.Signal), nil
+		}
+	}
+}
+
+// reap collects terminated child processes and reports whether the one with
+// the given PID is among them, along with its exit code.
+//
+// Only the command is reaped, plus any terminated orphans if reapOrphans is
+// set. Processes owned by command resources are never reaped, as their
+// exec.Cmd waits for them.
+func (s *supervisor) reap(pid int) (int, bool) {
+	if s.reapOrphans {
+		s.reapZombies(pid)
+	}
+	if pid <= 0 {
+		return 0, false
+	}
+	for {
+		var status syscall.WaitStatus
+		reaped, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || reaped <= 0 {
+			return 0, false
+		}
+		if status.Signaled() {
+			return 128 + int(status.Signal()), true
+		}
+		return status.ExitStatus(), true
+	}
+}
+
+// reapZombies reaps terminated children other than the command and those in
+// ownedProcesses. Children are found via /proc, as waiting for any child would
+// reap owned ones too.
+func (s *supervisor) reapZombies(cmdPid int) {
+	ownedProcesses.mu.Lock()
+	defer ownedProcesses.mu.Unlock()
+	for _, pid := range zombieChildren() {
+		if pid == cmdPid || ownedProcesses.pids[pid] {
+			continue
+		}
+		var status syscall.WaitStatus
+		if reaped, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err == nil && reaped == pid {
+			s.logger.Debugf("Reaped orphaned process with PID %d", reaped)
+		}
+	}
+}
+
+// zombieChildren returns the PIDs of all terminated, not yet reaped children
+// of this process.
+func zombieChildren() []int {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	self := os.Getpid()
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := ioutil.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// Format: <pid> (<comm>) <state> <ppid> ..., where comm may contain
+		// spaces and parentheses itself
+		i := strings.LastIndexByte(string(stat), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 2 || fields[0] != "Z" || fields[1] != strconv.Itoa(self) {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// unavailableResources returns the labels of all resources not available.
+func unavailableResources(statuses []resourceStatus) []string {
+	var down []string
+	for _, s := range statuses {
+		if s.State != available {
+			down = append(down, s.label())
+		}
+	}
+	return down
+}
+
+// parseSignal parses a signal given by name, with or without `SIG` prefix,
+// or by number.
+func parseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	switch strings.TrimPrefix(strings.ToUpper(s), "SIG") {
+	case "TERM":
+		return syscall.SIGTERM, nil
+	case "INT":
+		return syscall.SIGINT, nil
+	case "HUP":
+		return syscall.SIGHUP, nil
+	case "QUIT":
+		return syscall.SIGQUIT, nil
+	case "KILL":
+		return syscall.SIGKILL, nil
+	case "USR1":
+		return syscall.SIGUSR1, nil
+	case "USR2":
+		return syscall.SIGUSR2, nil
+	default:
+		return 0, fmt.Errorf("unsupported signal: %s", s)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSupervisorExitCode(t *testing.T) {
+	tests := map[string]int{
+		"exit 0":        0,
+		"exit 7":        7,
+		"kill -TERM $$": 128 + 15,
+	}
+	s := &supervisor{logger: NewLogger(silentLevel)}
+	for script, expected := range tests {
+		code, err := s.run([]string{"sh", "-c", script})
+		if err != nil {
+			t.Errorf("failed to run '%s': %v", script, err)
+		} else if code != expected {
+			t.Errorf("unexpected exit code of '%s': expected %d, got %d", script, expected, code)
+		}
+	}
+}
+
+func TestSupervisorCommandNotFound(t *testing.T) {
+	s := &supervisor{logger: NewLogger(silentLevel)}
+	if _, err := s.run([]string{"nonexistent-command-for-testing"}); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expected command not found error, got: %v", err)
+	}
+}
+
+func TestSupervisorRestartOnUnavailable(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "started")
+	// Exits on its own once restarted, runs until stopped otherwise
+	script := fmt.Sprintf("[ -f %[1]s ] && exit 4; touch %[1]s; exec sleep 10", marker)
+
+	for policy, expected := range map[unavailabilityPolicy]int{
+		stopOnUnavailable:    exitUnavailable,
+		restartOnUnavailable: 4,
+	} {
+		_ = os.Remove(marker)
+		res := &sequenceResource{results: []error{&unavailabilityError{errors.New("gone")}}}
+		targets := targetsOf(res)
+		statuses := []resourceStatus{{Resource: res, State: available}}
+
+		var reawaited int
+		s := &supervisor{
+			logger:      NewLogger(silentLevel),
+			monitor:     newMonitor(NewLogger(silentLevel), 10*time.Millisecond, targets, statuses),
+			policy:      policy,
+			stopSignal:  syscall.SIGTERM,
+			stopTimeout: time.Second,
+			reawait: func() ([]resourceStatus, error) {
+				reawaited++
+				return statuses, nil
+			},
+		}
+		code, err := s.run([]string{"sh", "-c", script})
+		if err != nil {
+			t.Fatalf("failed to run command: %v", err)
+		}
+		if code != expected {
+			t.Errorf("unexpected exit code with policy %s: expected %d, got %d", policy, expected, code)
+		}
+		if policy == restartOnUnavailable && reawaited != 1 {
+			t.Errorf("expected resources to be awaited again once, got %d", reawaited)
+		}
+	}
+}
+
+func TestSupervisorForwardSignals(t *testing.T) {
+	ready := filepath.Join(t.TempDir(), "ready")
+	script := fmt.Sprintf("trap 'exit 42' TERM; touch %s; while true; do sleep 0.05; done", ready)
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(ready); err == nil {
+				_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+
+	s := &supervisor{logger: NewLogger(silentLevel)}
+	code, err := s.run([]string{"sh", "-c", script})
+	if err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+	if code != 42 {
+		t.Errorf("expected command to exit by its trap of the forwarded signal, got code %d", code)
+	}
+}
+
+func TestSupervisorReapOrphans(t *testing.T) {
+	// Terminated children nobody waited for yet: an orphan, like one
+	// re-parented to PID 1, and one owned by e.g. a command resource
+	orphan := exec.Command("true")
+	owned := exec.Command("true")
+	for _, cmd := range []*exec.Cmd{orphan, owned} {
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("failed to start process: %v", err)
+		}
+	}
+	ownedProcesses.mu.Lock()
+	ownedProcesses.pids[owned.Process.Pid] = true
+	ownedProcesses.mu.Unlock()
+	defer func() {
+		ownedProcesses.mu.Lock()
+		delete(ownedProcesses.pids, owned.Process.Pid)
+		ownedProcesses.mu.Unlock()
+	}()
+
+	s := &supervisor{logger: NewLogger(silentLevel), reapOrphans: true}
+	deadline := time.Now().Add(5 * time.Second)
+	for reaped := false; !reaped; {
+		if time.Now().After(deadline) {
+			t.Fatal("orphaned process was not reaped")
+		}
+		time.Sleep(10 * time.Millisecond)
+		s.reap(0)
+		// Zombies still exist, unlike reaped processes
+		reaped = syscall.Kill(orphan.Process.Pid, 0) == syscall.ESRCH
+	}
+
+	if err := owned.Wait(); err != nil {
+		t.Errorf("expected owned process to be left for its exec.Cmd, got: %v", err)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	tests := map[string]syscall.Signal{
+		"TERM":    syscall.SIGTERM,
+		"SIGTERM": syscall.SIGTERM,
+		"hup":     syscall.SIGHUP,
+		"9":       syscall.SIGKILL,
+	}
+	for given, expected := range tests {
+		if actual, err := parseSignal(given); err != nil || actual != expected {
+			t.Errorf("unexpected signal of '%s': expected %v, got %v (%v)", given, expected, actual, err)
+		}
+	}
+	if _, err := parseSignal("UNKNOWN"); err == nil {
+		t.Error("expected error parsing unknown signal, but got none")
+	}
+}
@@ -30,6 +30,11 @@ type tcpResource struct {
 	url.URL
 }
 
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (r *tcpResource) String() string {
+	return redactURL(r.URL)
+}
+
 func (r *tcpResource) Await(ctx context.Context) error {
 	dialer := &net.Dialer{}
 	_, err := dialer.DialContext(ctx, r.URL.Scheme, r.URL.Host)
@@ -0,0 +1,124 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+)
+
+// tlsVersions maps the values of the 'tls-min-version' option to versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsOptions holds the TLS settings shared by all resources supporting TLS,
+// given as fragment keys:
+//
+//   - tls=skip-verify skips verifying the certificate of the server
+//   - tls-ca=<path> verifies the server against the CA certificates of a PEM file
+//   - tls-cert=<path> and tls-key=<path> present a client certificate
+//   - tls-server-name=<name> verifies the server against another name than its host
+//   - tls-min-version=<1.0|1.1|1.2|1.3> sets the minimum TLS version
+type tlsOptions struct {
+	skipVerify bool
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+	minVersion uint16
+}
+
+func parseTLSOptions(u url.URL) (tlsOptions, error) {
+	opts := tlsOptions{
+		caFile:     getOptOrDefault(u, "tls-ca", ""),
+		certFile:   getOptOrDefault(u, "tls-cert", ""),
+		keyFile:    getOptOrDefault(u, "tls-key", ""),
+		serverName: getOptOrDefault(u, "tls-server-name", ""),
+	}
+	switch val := getOptOrDefault(u, "tls", ""); val {
+	case "skip-verify":
+		opts.skipVerify = true
+	case "":
+	default:
+		return opts, &resourceConfigError{fmt.Errorf("%v: unknown value for 'tls' configuration: %v", redactURL(u), val)}
+	}
+	if (opts.certFile == "") != (opts.keyFile == "") {
+		return opts, &resourceConfigError{fmt.Errorf("%v: 'tls-cert' and 'tls-key' configuration must be given together", redactURL(u))}
+	}
+	if val := getOptOrDefault(u, "tls-min-version", ""); val != "" {
+		var ok bool
+		if opts.minVersion, ok = tlsVersions[val]; !ok {
+			return opts, &resourceConfigError{fmt.Errorf("%v: unknown value for 'tls-min-version' configuration: %v", redactURL(u), val)}
+		}
+	}
+	return opts, nil
+}
+
+// isSet reports whether any option deviates from the default TLS settings.
+func (o tlsOptions) isSet() bool {
+	return o != tlsOptions{}
+}
+
+// config returns the TLS configuration, reading the certificate files anew
+// every time to pick up renewed ones.
+func (o tlsOptions) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: o.skipVerify,
+		ServerName:         o.serverName,
+		MinVersion:         o.minVersion,
+	}
+	if o.caFile != "" {
+		pem, err := ioutil.ReadFile(o.caFile)
+		if err != nil {
+			return nil, &resourceConfigError{fmt.Errorf("failed to read CA certificates: %v", err)}
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, &resourceConfigError{errors.New("failed to read CA certificates: no certificate found in " + o.caFile)}
+		}
+	}
+	if o.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, &resourceConfigError{fmt.Errorf("failed to read client certificate: %v", err)}
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// tlsConfigOf returns the TLS configuration given by the fragment of a
+// resource URL, nil if it does not deviate from the default.
+func tlsConfigOf(u url.URL) (*tls.Config, error) {
+	opts, err := parseTLSOptions(u)
+	if err != nil || !opts.isSet() {
+		return nil, err
+	}
+	return opts.config()
+}
@@ -0,0 +1,245 @@
+// Copyright (C) 2016-2018 Betalo AB
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseTLSOptions(t *testing.T) {
+	valid := []string{
+		"https://localhost",
+		"https://localhost#tls=skip-verify",
+		"https://localhost#tls-ca=ca.pem&tls-server-name=example.com",
+		"https://localhost#tls-cert=cert.pem&tls-key=key.pem",
+		"https://localhost#tls-min-version=1.3",
+	}
+	for _, rawURL := range valid {
+		u, _ := url.Parse(rawURL)
+		if _, err := parseTLSOptions(*u); err != nil {
+			t.Errorf("Expected %s to be valid, got: %v", rawURL, err)
+		}
+	}
+
+	invalid := []string{
+		"https://localhost#tls=skipverify",
+		"https://localhost#tls-cert=cert.pem",
+		"https://localhost#tls-key=key.pem",
+		"https://localhost#tls-min-version=1.4",
+	}
+	for _, rawURL := range invalid {
+		u, _ := url.Parse(rawURL)
+		_, err := parseTLSOptions(*u)
+		if !errors.As(err, new(*resourceConfigError)) {
+			t.Errorf("Expected configuration error for %s, got: %v", rawURL, err)
+		}
+	}
+}
+
+func TestTLSOptionsOnPlainSchemes(t *testing.T) {
+	for _, rawURL := range []string{
+		"http://localhost#tls-ca=ca.pem",
+		"ws://localhost#tls=skip-verify",
+		"kafka://localhost#tls-cert=cert.pem&tls-key=key.pem",
+		"amqp://localhost#tls-server-name=example.com",
+		"tcp://localhost:80#tls-min-version=1.2",
+	} {
+		_, err := parseResource(rawURL)
+		if !errors.As(err, new(*resourceConfigError)) {
+			t.Errorf("Expected configuration error for %s, got: %v", rawURL, err)
+		}
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	cert, key, err := CertWithKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	u := url.URL{Scheme: "https", Host: "localhost"}
+	setFragment(&u, url.Values{
+		"tls-cert":        {certFile},
+		"tls-key":         {keyFile},
+		"tls-min-version": {"1.2"},
+	})
+	cfg, err := tlsConfigOf(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Certificates) != 1 {
+		t.Errorf("Expected client certificate to be loaded, got %d certificates", len(cfg.Certificates))
+	}
+	if cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected minimum TLS version 1.2, got: %x", cfg.MinVersion)
+	}
+
+	setFragment(&u, url.Values{"tls-cert": {keyFile}, "tls-key": {keyFile}})
+	if _, err := tlsConfigOf(u); !errors.As(err, new(*resourceConfigError)) {
+		t.Errorf("Expected configuration error for invalid certificate, got: %v", err)
+	}
+}
+
+func TestHTTPTLSCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		fragment  string
+		available bool
+	}{
+		{"", false},
+		{"tls-ca=" + caFile, true},
+		{"tls-ca=" + caFile + "&tls-server-name=example.com", true},
+		{"tls-ca=" + caFile + "&tls-server-name=wronghost", false},
+	}
+	for _, test := range tests {
+		resources, err := parseResources([]string{srv.URL + "#" + test.fragment})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = resources[0].Await(ctx)
+		if test.available && err != nil {
+			t.Errorf("Expected %s to be available, got: %v", test.fragment, err)
+		}
+		if !test.available && err == nil {
+			t.Errorf("Expected %s to fail verification, but succeeded", test.fragment)
+		}
+	}
+}
+
+func TestPostgreSQLTLSDialer(t *testing.T) {
+	// Borrow the certificate of a test server, valid for example.com and
+	// 127.0.0.1
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certServer.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certServer.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &tls.Config{Certificates: certServer.TLS.Certificates, MaxVersion: tls.VersionTLS12}
+
+	// Accepts TLS connections like PostgreSQL does, unless refusing TLS
+	serve := func(ln net.Listener, refuse bool) {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req := make([]byte, len(sslRequest))
+			if _, err := io.ReadFull(conn, req); err != nil || !bytes.Equal(req, sslRequest) {
+				_ = conn.Close()
+				continue
+			}
+			if refuse {
+				_, _ = conn.Write([]byte("N"))
+				_ = conn.Close()
+				continue
+			}
+			_, _ = conn.Write([]byte("S"))
+			_ = tls.Server(conn, serverConfig).Handshake()
+			_ = conn.Close()
+		}
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go serve(ln, false)
+	refusingLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer refusingLn.Close()
+	go serve(refusingLn, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		address   string
+		fragment  string
+		available bool
+	}{
+		{ln.Addr().String(), "tls-ca=" + caFile, true},
+		{ln.Addr().String(), "tls-ca=" + caFile + "&tls-server-name=example.com", true},
+		{ln.Addr().String(), "tls-ca=" + caFile + "&tls-server-name=wronghost", false},
+		{ln.Addr().String(), "tls-ca=" + caFile + "&tls-min-version=1.3", false},
+		{ln.Addr().String(), "tls=skip-verify&tls-server-name=wronghost", true},
+		{refusingLn.Addr().String(), "tls=skip-verify", false},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse("postgres://" + test.address + "/#" + test.fragment)
+		cfg, err := tlsConfigOf(*u)
+		if err != nil {
+			t.Fatalf("failed to read TLS configuration of %s: %v", test.fragment, err)
+		}
+		dialer := &postgresqlTLSDialer{config: cfg}
+		conn, err := dialer.DialContext(ctx, "tcp", test.address)
+		if err == nil {
+			_ = conn.Close()
+		}
+		if test.available && err != nil {
+			t.Errorf("Expected TLS handshake with %s to succeed, got: %v", test.fragment, err)
+		}
+		if !test.available && err == nil {
+			t.Errorf("Expected TLS handshake with %s to fail, but succeeded", test.fragment)
+		}
+	}
+
+	res, _ := parseResource("postgres://localhost:5432/app?sslmode=require#tls=skip-verify")
+	if err := res.Await(ctx); !errors.As(err, new(*resourceConfigError)) {
+		t.Errorf("Expected configuration error combining sslmode and TLS options, got: %v", err)
+	}
+}
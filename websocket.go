@@ -34,6 +34,11 @@ type websocketResource struct {
 	url.URL
 }
 
+// String implements the fmt.Stringer interface, with secrets redacted.
+func (r *websocketResource) String() string {
+	return redactURL(r.URL)
+}
+
 func (r *websocketResource) Await(ctx context.Context) error {
 	netDialer := &net.Dialer{}
 	dial := func(network, address string) (net.Conn, error) {
@@ -43,10 +48,15 @@ func (r *websocketResource) Await(ctx context.Context) error {
 	if deadline, ok := ctx.Deadline(); ok {
 		timeout = deadline.Sub(time.Now())
 	}
+	tlsConfig, err := tlsConfigOf(r.URL)
+	if err != nil {
+		return err
+	}
 	wsDialer := &websocket.Dialer{
 		NetDial:          dial,
 		HandshakeTimeout: timeout,
 		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  tlsConfig,
 	}
 
 	// IDEA(uwe): Use fragment to specify origin